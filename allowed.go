@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	pathpkg "path"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// readAllowed reads an allowlist: an address or pattern per line. Blank
+// lines and lines starting with # are skipped.
+func readAllowed(filename string) ([]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+	return patterns, nil
+}
+
+// checkAllowed fails when anything differs that no pattern allows. A
+// pattern allows an address, everything in it when it's a module, or the
+// addresses it matches with path.Match, such as aws_s3_bucket.*.
+func checkAllowed(opts *options, result tfdiff.DiffResult) error {
+	patterns, err := readAllowed(opts.allowedFile)
+	if err != nil {
+		return err
+	}
+
+	addresses := append(append(append([]string(nil), result.Added...), result.Modified...), result.Removed...)
+	if result.BackendChanged {
+		addresses = append(addresses, tfdiff.BackendAddress)
+	}
+	if result.ProvidersChanged {
+		addresses = append(addresses, tfdiff.RequiredProvidersAddress)
+	}
+
+	var unexpected []string
+	for _, address := range addresses {
+		allowed := false
+		for _, p := range patterns {
+			if ok, _ := pathpkg.Match(p, address); ok || refersTo(p, address) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			unexpected = append(unexpected, address)
+		}
+	}
+
+	if len(unexpected) > 0 {
+		return fmt.Errorf("changes outside %s:\n  %s", opts.allowedFile, strings.Join(unexpected, "\n  "))
+	}
+	return nil
+}
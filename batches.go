@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// batches partitions targets into groups to apply in sequence: every target
+// comes after the targets it refers to, directly or through the module calls
+// it is nested in. Targets left in a reference cycle form the last batch.
+func batches(targets []string, baseResources, targetResources map[string]*tfdiff.Resource) [][]string {
+	deps := make(map[string][]string)
+	for _, t := range targets {
+		for _, ref := range targetReferences(t, baseResources, targetResources) {
+			for _, u := range targets {
+				if u != t && refersTo(ref, u) {
+					deps[t] = append(deps[t], u)
+				}
+			}
+		}
+	}
+
+	done := make(map[string]bool)
+	remaining := targets
+	var result [][]string
+	for len(remaining) > 0 {
+		var batch, rest []string
+		for _, t := range remaining {
+			ready := true
+			for _, u := range deps[t] {
+				if !done[u] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				batch = append(batch, t)
+			} else {
+				rest = append(rest, t)
+			}
+		}
+
+		if len(batch) == 0 {
+			warn(fmt.Sprintf("%d targets refer to each other in a cycle; they are put in the last batch", len(rest)))
+			return append(result, rest)
+		}
+
+		for _, t := range batch {
+			done[t] = true
+		}
+		result = append(result, batch)
+		remaining = rest
+	}
+
+	return result
+}
+
+// targetReferences returns the references of address and of the module calls
+// enclosing it, from the target side or, for removed resources, the base.
+func targetReferences(address string, baseResources, targetResources map[string]*tfdiff.Resource) []string {
+	resources := targetResources
+	if _, ok := resources[address]; !ok {
+		resources = baseResources
+	}
+
+	var refs []string
+	for name, r := range resources {
+		if name == address || isModuleCall(name) && strings.HasPrefix(address, name+".") {
+			refs = append(refs, r.References...)
+		}
+	}
+	return refs
+}
+
+// A reference to a module call covers its instances and everything in it.
+func refersTo(ref, address string) bool {
+	return address == ref || strings.HasPrefix(address, ref+".") || strings.HasPrefix(address, ref+"[")
+}
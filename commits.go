@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// diffPerCommit reports, for every commit in base..HEAD, the resources it
+// changed compared to its first parent.
+func diffPerCommit(w io.Writer, opts *options) error {
+	baseBranch, err := baseRef(opts)
+	if err != nil {
+		return err
+	}
+
+	path, err := showPrefix(opts)
+	if err != nil {
+		return err
+	}
+
+	repo, fs, err := cloneRepository(opts, baseBranch)
+	if err != nil {
+		return err
+	}
+
+	base, err := tfdiff.ResolveRevision(repo, baseBranch)
+	if err != nil {
+		return shallowError(opts, fmt.Errorf("%s: %s", baseBranch, err))
+	}
+
+	head, err := tfdiff.ResolveRevision(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	commits, err := commitRange(repo, *base, *head, opts.maxHistory)
+	if err != nil {
+		return shallowError(opts, err)
+	}
+
+	for _, c := range commits {
+		var baseResources map[string]*tfdiff.Resource
+		if len(c.ParentHashes) > 0 {
+			baseResources, err = resourcesAt(repo, fs, c.ParentHashes[0], path, opts)
+			if err != nil {
+				return shallowError(opts, err)
+			}
+		}
+
+		targetResources, err := resourcesAt(repo, fs, c.Hash, path, opts)
+		if err != nil {
+			return err
+		}
+
+		differ := newDiffer(opts)
+		result := onlyAttributes(opts, differ, differ.Diff(baseResources, targetResources), baseResources, targetResources)
+
+		fmt.Fprintf(w, "%s %s\n", c.Hash.String()[:7], strings.SplitN(c.Message, "\n", 2)[0])
+		for _, name := range result.Added {
+			fmt.Fprintf(w, "  + %s\n", name)
+		}
+		for _, name := range result.Modified {
+			fmt.Fprintf(w, "  ~ %s\n", name)
+		}
+		for _, name := range result.Removed {
+			fmt.Fprintf(w, "  - %s\n", name)
+		}
+	}
+
+	return nil
+}
+
+// commitRange returns the commits reachable from head but not from base,
+// oldest first. With maxHistory, only that many commits are walked from
+// base, and finding more than that many from head is an error, which keeps
+// deep histories from being walked in full.
+func commitRange(repo *git.Repository, base, head plumbing.Hash, maxHistory int) ([]*object.Commit, error) {
+	excluded := make(map[plumbing.Hash]bool)
+
+	iter, err := repo.Log(&git.LogOptions{From: base})
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(c *object.Commit) error {
+		if maxHistory > 0 && len(excluded) >= maxHistory {
+			return storer.ErrStop
+		}
+		excluded[c.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// history behind the excluded commits is excluded too, so it isn't
+	// walked
+	var commits []*object.Commit
+	seen := map[plumbing.Hash]bool{head: true}
+	queue := []plumbing.Hash{head}
+	for len(queue) > 0 {
+		hash := queue[0]
+		queue = queue[1:]
+		if excluded[hash] {
+			continue
+		}
+
+		c, err := repo.CommitObject(hash)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, c)
+		if maxHistory > 0 && len(commits) > maxHistory {
+			return nil, fmt.Errorf("no common ancestor of HEAD and the base within %d commits (--max-history); fetch more history or raise the limit", maxHistory)
+		}
+
+		for _, p := range c.ParentHashes {
+			if !seen[p] {
+				seen[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+
+	sort.SliceStable(commits, func(i, j int) bool {
+		return commits[i].Committer.When.After(commits[j].Committer.When)
+	})
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	return commits, nil
+}
+
+func resourcesAt(repo *git.Repository, fs billy.Filesystem, hash plumbing.Hash, path string, opts *options) (map[string]*tfdiff.Resource, error) {
+	if err := checkoutRevision(repo, hash.String()); err != nil {
+		return nil, err
+	}
+
+	if opts.preCommand != "" {
+		generated, err := generateCopy(opts, fs, path)
+		if err != nil {
+			return nil, err
+		}
+		fs = generated
+	}
+
+	resources, err := parseDir(opts, fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	filterResources(opts, resources)
+	return resources, nil
+}
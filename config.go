@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultConfigFile = ".tfdiff.json"
+	defaultEnvPath    = "envs/{env}"
+)
+
+// configFile is a config file such as
+//
+//	{"profiles": {"ci": {"format": "json", "exit-code": true, "normalize": ["strip-tags"]}}, "env_path": "envs/{env}"}
+//
+// where profiles map flag names to values and env_path is where --env
+// finds the directory of an environment, relative to the config file.
+type configFile struct {
+	Profiles map[string]map[string]interface{} `json:"profiles"`
+	EnvPath  string                            `json:"env_path"`
+}
+
+func readConfig(filename string) (*configFile, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var c configFile
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return &c, nil
+}
+
+// configPath returns the config file, relative to --chdir when given.
+func configPath(opts *options) string {
+	if opts.chdir == "" || filepath.IsAbs(opts.configFile) {
+		return opts.configFile
+	}
+	return filepath.Join(opts.chdir, opts.configFile)
+}
+
+// resolveEnv sets --chdir to the directory of the --env environment, so
+// both sides are read from there. Modules it calls, such as shared ones
+// outside of it, are read too, unless --no-module-recursion is given.
+func resolveEnv(opts *options) error {
+	filename := configPath(opts)
+	envPath := defaultEnvPath
+	conf, err := readConfig(filename)
+	if err == nil && conf.EnvPath != "" {
+		envPath = conf.EnvPath
+	} else if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	dir := filepath.Join(filepath.Dir(filename), filepath.FromSlash(strings.ReplaceAll(envPath, "{env}", opts.env)))
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("--env %s: %s isn't a directory", opts.env, dir)
+	}
+	opts.chdir = dir
+	return nil
+}
+
+// applyProfile sets the flags of the named profile that weren't given on
+// the command line, so explicit flags still win over the profile.
+func applyProfile(c *cobra.Command, filename, name string) error {
+	conf, err := readConfig(filename)
+	if err != nil {
+		return err
+	}
+
+	profile, ok := conf.Profiles[name]
+	if !ok {
+		var names []string
+		for n, _ := range conf.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("%s: no profile %q (available: %s)", filename, name, strings.Join(names, ", "))
+	}
+
+	flags := c.Flags()
+	for flag, value := range profile {
+		f := flags.Lookup(flag)
+		if f == nil {
+			return fmt.Errorf("%s: profile %q: unknown flag %q", filename, name, flag)
+		}
+		if f.Changed {
+			continue
+		}
+
+		values := []interface{}{value}
+		if list, ok := value.([]interface{}); ok {
+			values = list
+		}
+		for _, v := range values {
+			if err := flags.Set(flag, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("%s: profile %q: %s: %s", filename, name, flag, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveEnv(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "environments", "prod"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, defaultConfigFile), []byte(`{"env_path": "environments/{env}"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{chdir: dir, configFile: defaultConfigFile, env: "prod"}
+	if err := resolveEnv(opts); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "environments", "prod"); opts.chdir != want {
+		t.Errorf("chdir = %s, want %s", opts.chdir, want)
+	}
+	if cwd, _ := os.Getwd(); cwd != wd {
+		t.Errorf("working directory changed to %s", cwd)
+	}
+
+	opts = &options{chdir: dir, configFile: defaultConfigFile, env: "dev"}
+	if err := resolveEnv(opts); err == nil {
+		t.Error("resolveEnv() succeeded for a missing environment")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// addDataDependents reports the resources referring to a differing data
+// source, directly or through other data sources, as modified. Their
+// references to it can't be evaluated, so they compare equal although the
+// values they read may change. Targeting them brings the data source into
+// the plan too.
+func addDataDependents(result *tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) {
+	changed := make(map[string]bool)
+	for _, address := range append(append([]string{}, result.Added...), result.Modified...) {
+		if isDataSource(address) {
+			changed[address] = true
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+
+	differing := make(map[string]bool)
+	for _, address := range result.Targets() {
+		differing[address] = true
+	}
+
+	var dependents []string
+	for grown := true; grown; {
+		grown = false
+		for name, _ := range targetResources {
+			if differing[name] || tfdiff.IsSetting(name) {
+				continue
+			}
+			if _, ok := baseResources[name]; !ok {
+				continue
+			}
+			for _, ref := range targetReferences(name, baseResources, targetResources) {
+				if dataSourceChanged(ref, changed) {
+					differing[name] = true
+					dependents = append(dependents, name)
+					if isDataSource(name) {
+						changed[name] = true
+					}
+					grown = true
+					break
+				}
+			}
+		}
+	}
+	if len(dependents) == 0 {
+		return
+	}
+
+	sort.Strings(dependents)
+	result.Modified = append(result.Modified, dependents...)
+	sort.Strings(result.Modified)
+	result.Warnings = append(result.Warnings, "also targeted for reading changed data sources: "+strings.Join(dependents, ", "))
+}
+
+func dataSourceChanged(ref string, changed map[string]bool) bool {
+	for address, _ := range changed {
+		if refersTo(ref, address) || refersTo(address, ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyDataSources adds the resources reading changed data sources to
+// result, or, with --data-sources=off, leaves the data sources out of it.
+// Whether the data sources themselves are targeted is up to isTarget.
+func applyDataSources(opts *options, result *tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) {
+	if opts.dataSources == "off" {
+		dropDataSources(result)
+		return
+	}
+	addDataDependents(result, baseResources, targetResources)
+}
+
+// dropDataSources leaves the data sources out of result, for
+// --data-sources=off.
+func dropDataSources(result *tfdiff.DiffResult) {
+	drop := func(addresses []string) []string {
+		var kept []string
+		for _, address := range addresses {
+			if !isDataSource(address) {
+				kept = append(kept, address)
+			}
+		}
+		return kept
+	}
+	result.Added = drop(result.Added)
+	result.Removed = drop(result.Removed)
+	result.Modified = drop(result.Modified)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+func TestDataSources(t *testing.T) {
+	parse := func(ami string) map[string]*tfdiff.Resource {
+		resources, err := (&tfdiff.Parser{}).Parse([]tfdiff.File{{Name: "main.tf", Content: []byte(`
+data "aws_ami" "ubuntu" {
+  name_regex = "` + ami + `"
+}
+resource "aws_instance" "web" {
+  ami = data.aws_ami.ubuntu.id
+}
+resource "aws_instance" "other" {}
+`)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+	base, target := parse("ubuntu-20"), parse("ubuntu-22")
+
+	tests := []struct {
+		dataSources string
+		modified    []string
+		targets     []string
+	}{
+		{"target", []string{"aws_instance.web", "data.aws_ami.ubuntu"}, []string{"aws_instance.web", "data.aws_ami.ubuntu"}},
+		{"", []string{"aws_instance.web", "data.aws_ami.ubuntu"}, []string{"aws_instance.web", "data.aws_ami.ubuntu"}},
+		{"dependents", []string{"aws_instance.web", "data.aws_ami.ubuntu"}, []string{"aws_instance.web"}},
+		{"off", nil, nil},
+	}
+	for _, tt := range tests {
+		opts := &options{dataSources: tt.dataSources}
+		result := newDiffer(opts).Diff(base, target)
+		applyDataSources(opts, &result, base, target)
+		if !reflect.DeepEqual(result.Modified, tt.modified) {
+			t.Errorf("--data-sources=%s: Modified = %v, want %v", tt.dataSources, result.Modified, tt.modified)
+		}
+		if got := targets(opts, result); !reflect.DeepEqual(got, tt.targets) {
+			t.Errorf("--data-sources=%s: targets = %v, want %v", tt.dataSources, got, tt.targets)
+		}
+	}
+}
+
+func TestDataSourcesUnknown(t *testing.T) {
+	err := diff(&options{dataSources: "on"})
+	if err == nil || !strings.Contains(err.Error(), "--data-sources") {
+		t.Errorf("diff() = %v, want an error about --data-sources=on", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// readDefaults reads a defaults file such as
+//
+//	{"aws_instance.monitoring": false, "aws_s3_bucket.force_destroy": false}
+func readDefaults(filename string) (map[string]map[string]cty.Value, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	defaults := make(map[string]map[string]cty.Value)
+	for key, r := range raw {
+		kv := strings.SplitN(key, ".", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("%s: %q is not of the form type.attribute", filename, key)
+		}
+
+		t, err := ctyjson.ImpliedType(r)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, key, err)
+		}
+		v, err := ctyjson.Unmarshal(r, t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, key, err)
+		}
+
+		if defaults[kv[0]] == nil {
+			defaults[kv[0]] = make(map[string]cty.Value)
+		}
+		defaults[kv[0]][kv[1]] = v
+	}
+
+	return defaults, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// resourceChange tells why a resource differs. Reason is added, removed,
+// modified, or moved for a resource moved by a moved block, with its
+// changed attribute paths, if any, in Attributes. FileRenamedFrom is set
+// when the file defining the resource was renamed, which isn't a change.
+type resourceChange struct {
+	Address         string   `json:"address"`
+	Reason          string   `json:"reason"`
+	MovedFrom       string   `json:"moved_from,omitempty"`
+	Attributes      []string `json:"changed_attributes,omitempty"`
+	FileRenamedFrom string   `json:"file_renamed_from,omitempty"`
+}
+
+func resourceChanges(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) []resourceChange {
+	differ := newDiffer(opts)
+
+	changes := []resourceChange{}
+	for _, address := range result.Added {
+		changes = append(changes, resourceChange{Address: address, Reason: "added"})
+	}
+	for _, address := range result.Modified {
+		c := resourceChange{Address: address, Reason: "modified"}
+		base, target := baseResources[address], targetResources[address]
+		if base == nil {
+			// paired with a resource moved by a moved block
+			for _, from := range target.MovedFrom {
+				if base = baseResources[from]; base != nil {
+					c.Reason, c.MovedFrom = "moved", from
+					break
+				}
+			}
+		}
+		c.Attributes = differ.AttributeChanges(base, target)
+		if base != nil && base.File != target.File && opts.fileRenames[target.File] == base.File {
+			c.FileRenamedFrom = base.File
+		}
+		changes = append(changes, c)
+	}
+	for _, address := range result.Removed {
+		changes = append(changes, resourceChange{Address: address, Reason: "removed"})
+	}
+	return changes
+}
+
+// printExplanation prints a line per emitted target telling why it differs,
+// so a targeted apply can be checked before it is trusted.
+func printExplanation(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) {
+	for _, c := range resourceChanges(opts, result, baseResources, targetResources) {
+		if !isTarget(opts, c.Address) {
+			continue
+		}
+		target := c.Address
+		if opts.relativeModule != "" {
+			if !strings.HasPrefix(c.Address, opts.relativeModule+".") {
+				continue
+			}
+			target = strings.TrimPrefix(c.Address, opts.relativeModule+".")
+		}
+
+		var reason string
+		switch c.Reason {
+		case "added":
+			reason = "added (not in base)"
+		case "removed":
+			reason = "removed (not in target)"
+		case "moved":
+			reason = "moved from " + c.MovedFrom
+		default:
+			reason = c.Reason
+		}
+		if c.Reason == "modified" || c.Reason == "moved" {
+			if len(c.Attributes) == 0 {
+				reason += ": values unknown before apply"
+			} else {
+				reason += ": " + strings.Join(c.Attributes, ", ")
+			}
+		}
+		if c.FileRenamedFrom != "" {
+			reason += " (file renamed from " + c.FileRenamedFrom + ")"
+		}
+		fmt.Fprintf(w, "%s: %s\n", target, reason)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// fileRenames returns the files git's rename detection finds renamed
+// between the base and HEAD, by new name. Renames that aren't committed yet
+// aren't seen. When the base isn't a revision of the current repository,
+// there are none.
+func fileRenames(opts *options) map[string]string {
+	if opts.noGit || opts.baseline != "" || opts.stateJSON != "" || opts.baseWorktree != "" || opts.baseRepo != "" || opts.baseArchive != "" {
+		return nil
+	}
+
+	base, err := baseRef(opts)
+	if err != nil {
+		return nil
+	}
+	repo, err := git.PlainOpenWithOptions(workDir(opts), &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil
+	}
+
+	var trees []*object.Tree
+	for _, rev := range []string{base, "HEAD"} {
+		hash, err := tfdiff.ResolveRevision(repo, rev)
+		if err != nil {
+			return nil
+		}
+		commit, err := repo.CommitObject(*hash)
+		if err != nil {
+			return nil
+		}
+		tree, err := commit.Tree()
+		if err != nil {
+			return nil
+		}
+		trees = append(trees, tree)
+	}
+
+	changes, err := object.DiffTreeWithOptions(context.Background(), trees[0], trees[1], object.DefaultDiffTreeOptions)
+	if err != nil {
+		warn("detecting file renames: " + err.Error())
+		return nil
+	}
+
+	renames := make(map[string]string)
+	for _, c := range changes {
+		if c.From.Name != "" && c.To.Name != "" && c.From.Name != c.To.Name {
+			renames[c.To.Name] = c.From.Name
+		}
+	}
+	return renames
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// listFiles prints the files parsed for each side, module files included,
+// to check what a diff covers. The base side is only listed when one is
+// given, since finding the default base may mean cloning.
+func listFiles(w io.Writer, opts *options) error {
+	if err := parseVars(opts); err != nil {
+		return err
+	}
+
+	path, err := showPrefix(opts)
+	if err != nil {
+		return err
+	}
+
+	fs, err := getContent(opts, "", path)
+	if err != nil {
+		return err
+	}
+	if _, err := parseDir(opts, fs, path); err != nil {
+		return err
+	}
+	printFiles(w, "working tree", opts.filesRead)
+
+	if opts.base == "" && opts.baseWorktree == "" && opts.baseRepo == "" && opts.baseArchive == "" {
+		return nil
+	}
+
+	opts.filesRead = nil
+	basePath := basePrefix(opts, path)
+	fs, err = baseContent(opts, basePath)
+	if err != nil {
+		return err
+	}
+	if _, err := parseDir(opts, fs, basePath); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	printFiles(w, "base", opts.filesRead)
+
+	return nil
+}
+
+func printFiles(w io.Writer, side string, names []string) {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+
+	fmt.Fprintf(w, "# %s\n", side)
+	for _, name := range unique {
+		fmt.Fprintln(w, name)
+	}
+}
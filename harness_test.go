@@ -0,0 +1,466 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// testRepository is a repository in a temporary directory, whose branches
+// and commits are made with go-git.
+type testRepository struct {
+	t    *testing.T
+	dir  string
+	repo *git.Repository
+}
+
+// newTestRepository makes a repository with files committed on master.
+func newTestRepository(t *testing.T, files map[string]string) *testRepository {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRepository{t: t, dir: dir, repo: repo}
+	r.commit(files)
+	return r
+}
+
+// write changes files in the worktree without committing them. An empty
+// content removes the file.
+func (r *testRepository) write(files map[string]string) {
+	r.t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(r.dir, filepath.FromSlash(name))
+		if content == "" {
+			if err := os.Remove(filename); err != nil {
+				r.t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			r.t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+}
+
+// commit writes files and commits every change on the current branch.
+func (r *testRepository) commit(files map[string]string) plumbing.Hash {
+	r.t.Helper()
+	r.write(files)
+
+	w, err := r.repo.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err := w.AddWithOptions(&git.AddOptions{All: true}); err != nil {
+		r.t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "t", Email: "t@example.com", When: time.Now()}
+	hash, err := w.Commit("commit", &git.CommitOptions{Author: sig})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return hash
+}
+
+// branch creates the branch name at HEAD and checks it out.
+func (r *testRepository) branch(name string) {
+	r.t.Helper()
+	w, err := r.repo.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(name), Create: true}); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// detach checks out the commit hash, leaving HEAD detached as in CI.
+func (r *testRepository) detach(hash plumbing.Hash) {
+	r.t.Helper()
+	w, err := r.repo.Worktree()
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Hash: hash}); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// deleteBranch removes the branch name, which isn't checked out.
+func (r *testRepository) deleteBranch(name string) {
+	r.t.Helper()
+	if err := r.repo.Storer.RemoveReference(plumbing.NewBranchReferenceName(name)); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// diff compares the worktree of dir, relative to the repository, with its
+// base side, as tfdiff run there with opts would.
+func (r *testRepository) diff(dir string, opts *options) tfdiff.DiffResult {
+	r.t.Helper()
+	opts.chdir = filepath.Join(r.dir, filepath.FromSlash(dir))
+	base, target, err := loadResources(opts)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return newDiffer(opts).Diff(base, target)
+}
+
+func TestHarnessBranches(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"main.tf": `
+resource "aws_instance" "a" {
+  ami = "ami-1"
+}
+resource "aws_instance" "b" {}
+`,
+	})
+	r.branch("feature")
+	r.commit(map[string]string{
+		"main.tf": `
+resource "aws_instance" "a" {
+  ami = "ami-2"
+}
+resource "aws_instance" "c" {}
+`,
+	})
+
+	result := r.diff("", &options{})
+	if want := []string{"aws_instance.c"}; !reflect.DeepEqual(result.Added, want) {
+		t.Errorf("Added = %v, want %v", result.Added, want)
+	}
+	if want := []string{"aws_instance.b"}; !reflect.DeepEqual(result.Removed, want) {
+		t.Errorf("Removed = %v, want %v", result.Removed, want)
+	}
+	if want := []string{"aws_instance.a"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+
+	// --base compares against any branch, here the one checked out
+	result = r.diff("", &options{base: "feature"})
+	if len(result.Added)+len(result.Removed)+len(result.Modified) > 0 {
+		t.Errorf("feature differs from itself: %+v", result)
+	}
+}
+
+func TestHarnessBaseRef(t *testing.T) {
+	r := newTestRepository(t, map[string]string{"main.tf": `resource "a_b" "c" {}`})
+
+	// a branch merely containing main isn't main
+	r.branch("maintenance")
+	r.deleteBranch("master")
+	if got, err := baseRef(&options{chdir: r.dir}); err != nil || got != "maintenance" {
+		t.Errorf("baseRef() = %q, %v, want maintenance", got, err)
+	}
+
+	r.branch("master")
+	if got, err := baseRef(&options{chdir: r.dir}); err != nil || got != "master" {
+		t.Errorf("baseRef() = %q, %v, want master", got, err)
+	}
+
+	r.branch("main")
+	if got, err := baseRef(&options{chdir: r.dir}); err != nil || got != "main" {
+		t.Errorf("baseRef() = %q, %v, want main over master", got, err)
+	}
+}
+
+func TestHarnessUnknownBase(t *testing.T) {
+	r := newTestRepository(t, map[string]string{"main.tf": `resource "a_b" "c" {}`})
+
+	if _, err := getContent(&options{chdir: r.dir}, "no-such-branch", ""); err == nil {
+		t.Error("getContent() compared HEAD for a base that doesn't exist")
+	}
+}
+
+func TestHarnessGlobCharacters(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"env[prod]/main.tf": `resource "a_b" "c" { x = 1 }`,
+		"envp/main.tf":      `resource "a_b" "d" { x = 1 }`,
+	})
+	r.write(map[string]string{"env[prod]/main.tf": `resource "a_b" "c" { x = 2 }`})
+
+	result := r.diff("env[prod]", &options{})
+	if want := []string{"a_b.c"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+	if len(result.Added)+len(result.Removed) > 0 {
+		t.Errorf("files of other directories were read: %+v", result)
+	}
+}
+
+func TestHarnessDetachedHead(t *testing.T) {
+	r := newTestRepository(t, map[string]string{"main.tf": `resource "a_b" "c" { x = 1 }`})
+	head := r.commit(map[string]string{"main.tf": `
+resource "a_b" "c" { x = 2 }
+resource "a_b" "d" {}
+`})
+	r.detach(head)
+	r.write(map[string]string{"main.tf": `
+resource "a_b" "c" { x = 3 }
+resource "a_b" "d" {}
+`})
+
+	tests := []struct {
+		base  string
+		added []string
+	}{
+		{"", nil},
+		{"master", nil},
+		{"HEAD", nil},
+		{"HEAD~1", []string{"a_b.d"}},
+		{head.String(), nil},
+	}
+	for _, tt := range tests {
+		result := r.diff("", &options{base: tt.base})
+		if want := []string{"a_b.c"}; !reflect.DeepEqual(result.Modified, want) {
+			t.Errorf("--base %q: Modified = %v, want %v", tt.base, result.Modified, want)
+		}
+		if !reflect.DeepEqual(result.Added, tt.added) {
+			t.Errorf("--base %q: Added = %v, want %v", tt.base, result.Added, tt.added)
+		}
+	}
+}
+
+func TestHarnessRepositoryRoot(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"main.tf":             `resource "a_b" "c" {}`,
+		"extra.tf.json":       `{"resource": {"a_b": {"d": {}}}}`,
+		"terraform.tfvars":    `x = 1`,
+		"sub/main.tf":         `resource "a_b" "e" {}`,
+		"README.md":           "not configuration",
+		"main_override.tf":    `resource "a_b" "c" { x = 1 }`,
+		".terraform/cache.tf": `resource "a_b" "f" {}`,
+	})
+
+	names := func(fs billy.Filesystem) []string {
+		files, err := readFiles(fs, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	opts := &options{chdir: r.dir}
+	path, err := showPrefix(opts)
+	if err != nil || path != "" {
+		t.Fatalf("showPrefix() = %q, %v, want an empty prefix", path, err)
+	}
+	base, err := getContent(opts, "master", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := getContent(opts, "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var want []string
+	for _, pattern := range tfdiff.FilePatterns {
+		matches, err := filepath.Glob(filepath.Join(r.dir, pattern))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range matches {
+			want = append(want, filepath.Base(m))
+		}
+	}
+	sort.Strings(want)
+
+	if got := names(base); !reflect.DeepEqual(got, want) {
+		t.Errorf("base side reads %v, want %v", got, want)
+	}
+	if got := names(target); !reflect.DeepEqual(got, want) {
+		t.Errorf("target side reads %v, want %v", got, want)
+	}
+}
+
+func TestHarnessExcludeInclude(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"infra/main.tf":                 `resource "a_b" "c" { x = 1 }`,
+		"infra/extra.tf":                `resource "a_b" "d" { x = 1 }`,
+		"infra/examples/simple/main.tf": `resource "a_b" "c" { x = 1 }`,
+	})
+	r.write(map[string]string{
+		"infra/main.tf":                 `resource "a_b" "c" { x = 2 }`,
+		"infra/extra.tf":                `resource "a_b" "d" { x = 2 }`,
+		"infra/examples/simple/main.tf": `resource "a_b" "e" {}`,
+	})
+
+	tests := []struct {
+		opts     *options
+		modified []string
+	}{
+		// the example is a separate root module otherwise
+		{&options{recursive: true, exclude: []string{"examples"}}, []string{"a_b.c", "a_b.d"}},
+		{&options{recursive: true, exclude: []string{"./examples/"}}, []string{"a_b.c", "a_b.d"}},
+		{&options{include: []string{"main.tf"}}, []string{"a_b.c"}},
+		{&options{include: []string{"*.tf"}, exclude: []string{"extra.tf"}}, []string{"a_b.c"}},
+	}
+	for _, tt := range tests {
+		result := r.diff("infra", tt.opts)
+		if !reflect.DeepEqual(result.Modified, tt.modified) {
+			t.Errorf("--exclude %v --include %v: Modified = %v, want %v", tt.opts.exclude, tt.opts.include, result.Modified, tt.modified)
+		}
+		if len(result.Added)+len(result.Removed) > 0 {
+			t.Errorf("--exclude %v --include %v: Added = %v, Removed = %v, want none", tt.opts.exclude, tt.opts.include, result.Added, result.Removed)
+		}
+	}
+}
+
+func TestHarnessSmartFilter(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"variables.tf": `variable "size" { default = 1 }`,
+		"sized.tf":     `resource "a_b" "sized" { size = var.size }`,
+		"fixed.tf":     `resource "a_b" "fixed" { size = 1 }`,
+		"refers.tf":    `resource "a_b" "refers" { id = a_b.changed.id }`,
+		"changed.tf": `
+resource "a_b" "changed" { x = 1 }
+module "m" {
+  source = "./m"
+}
+`,
+		"m/main.tf": `resource "a_b" "inner" {}`,
+	})
+
+	// every resource differs, as far as the filter knows
+	all := []string{"a_b.changed", "a_b.fixed", "a_b.refers", "a_b.sized", "module.m", "module.m.a_b.inner"}
+	filter := func(opts *options) []string {
+		opts.chdir = r.dir
+		base, target, err := loadResources(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := smartFilter(opts, tfdiff.DiffResult{Modified: all}, base, target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result.Modified
+	}
+
+	if got := filter(&options{}); len(got) > 0 {
+		t.Errorf("kept %v with nothing changed", got)
+	}
+
+	r.write(map[string]string{"changed.tf": `
+resource "a_b" "changed" { x = 2 }
+module "m" {
+  source = "./m"
+}
+`})
+	if got, want := filter(&options{}), []string{"a_b.changed", "a_b.refers", "module.m", "module.m.a_b.inner"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+
+	// a changed default reaches resources in files that didn't change
+	r.write(map[string]string{"variables.tf": `variable "size" { default = 2 }`})
+	if got, want := filter(&options{}), []string{"a_b.changed", "a_b.refers", "a_b.sized", "module.m", "module.m.a_b.inner"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kept %v, want %v", got, want)
+	}
+
+	if got := filter(&options{full: true}); !reflect.DeepEqual(got, all) {
+		t.Errorf("--full kept %v, want %v", got, all)
+	}
+}
+
+func TestHarnessSmartFilterTfvars(t *testing.T) {
+	r := newTestRepository(t, map[string]string{
+		"main.tf": `
+variable "size" {}
+resource "a_b" "sized" { size = var.size }
+`,
+		"other.tf":         `resource "a_b" "fixed" { size = 1 }`,
+		"terraform.tfvars": `size = 1`,
+	})
+	r.write(map[string]string{"terraform.tfvars": `size = 2`})
+
+	opts := &options{chdir: r.dir}
+	base, target, err := loadResources(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := smartFilter(opts, tfdiff.DiffResult{Modified: []string{"a_b.fixed", "a_b.sized"}}, base, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a_b.sized"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("kept %v, want %v", result.Modified, want)
+	}
+}
+
+func TestHarnessSiblingRoots(t *testing.T) {
+	env := func(size string) string {
+		return `
+module "app" {
+  source = "../../modules/app"
+  size   = ` + size + `
+}
+resource "a_b" "c" { size = ` + size + ` }
+`
+	}
+	app := `
+variable "size" {}
+resource "a_b" "app" { size = var.size }
+`
+	r := newTestRepository(t, map[string]string{
+		"main.tf":             `resource "a_b" "top" { x = 1 }`,
+		"envs/dev/main.tf":    env("1"),
+		"envs/prod/main.tf":   env("3"),
+		"modules/app/main.tf": app,
+	})
+	r.write(map[string]string{
+		"main.tf":           `resource "a_b" "top" { x = 2 }`,
+		"envs/dev/main.tf":  env("2"),
+		"envs/prod/main.tf": env("4"),
+	})
+
+	// the roots both define a_b.c, and are left out
+	result := r.diff("", &options{recursive: true})
+	if want := []string{"a_b.top"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+
+	_, warnings, err := parseFiles(&options{recursive: true}, osfs.New(r.dir), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var skipped []string
+	for _, w := range warnings {
+		for _, dir := range []string{"envs/dev", "envs/prod", "modules/app"} {
+			if strings.HasPrefix(w, "--recursive: "+dir+" is skipped") {
+				skipped = append(skipped, dir)
+			}
+		}
+	}
+	if want := []string{"envs/dev", "envs/prod"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %v, want %v: %q", skipped, want, warnings)
+	}
+
+	// each root compares on its own
+	result = r.diff("envs/prod", &options{recursive: true})
+	if want := []string{"a_b.c", "module.app", "module.app.a_b.app"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("envs/prod: Modified = %v, want %v", result.Modified, want)
+	}
+}
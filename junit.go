@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// Plain character data would escape the newlines between attribute paths.
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// writeJUnit reports every differing resource as a test case named after its
+// address, classed by the kind of change, so the blast radius of a change
+// shows up in CI test reports. With --exit-code, which fails the build on
+// any difference, every test case is a failure too.
+func writeJUnit(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	differ := newDiffer(opts)
+	suite := junitTestSuite{Name: "tfdiff"}
+
+	cases := func(addresses []string, change string) {
+		for _, address := range addresses {
+			tc := junitTestCase{ClassName: change, Name: address}
+			if opts.exitCode {
+				tc.Failure = &junitFailure{Message: address + " is " + change}
+				suite.Failures++
+			}
+			if change == "modified" {
+				tc.SystemOut = &junitOutput{Text: strings.Join(differ.AttributeChanges(baseResources[address], targetResources[address]), "\n")}
+			}
+			suite.TestCases = append(suite.TestCases, tc)
+		}
+	}
+	cases(result.Added, "added")
+	cases(result.Modified, "modified")
+	cases(result.Removed, "removed")
+	suite.Tests = len(suite.TestCases)
+
+	fmt.Fprint(w, xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+
+	return nil
+}
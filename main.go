@@ -1,257 +1,1323 @@
 package main
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"github.com/go-git/go-billy/v5"
 	"github.com/go-git/go-billy/v5/memfs"
-	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-billy/v5/osfs"
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/storage/memory"
-	"io/ioutil"
 	"os"
 	"os/exec"
+	pathpkg "path"
 	"path/filepath"
-	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
-	"github.com/hashicorp/hcl/v2"
-	"github.com/hashicorp/hcl/v2/hclparse"
-	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
 	"github.com/spf13/cobra"
 	"github.com/zclconf/go-cty/cty"
 )
 
-type Resource struct {
-	Name       string
-	Attributes map[string]cty.Value
-	Blocks     map[string]Block
-}
+var errChanged = errors.New("resource changed")
+
+// errDiffers makes --exit-code exit with 1, like git diff --exit-code.
+// Errors exit with 2 then, so differences can be told from failures.
+var errDiffers = errors.New("resources differ")
+
+const cloneAttempts = 3
+
+var warned = make(map[string]bool)
+
+type options struct {
+	base         string
+	baseWorktree string
+	baseRepo     string
+	baseArchive  string
+	basePath     string
+	chdir        string
+	summary      bool
+	explain      bool
+	exitCode     bool
+	stats        bool
+	strict       bool
+	configFiles  int
+	filesRead    []string
+	vars         []string
+	overrides    map[string]string
+	full         bool
+	format       string
+	ignoreFiles  []string
+	excludePaths []string
+	exclude      []string
+	include      []string
+	scope        string
+	only         string
+	baseline     string
+	snapshotSave string
+	renamesFile  string
+	normalizers  []string
+	perCommit    bool
+
+	checkTargetable bool
+	noRetry         bool
+	ignoreOrder     bool
+
+	noModuleRecursion bool
+	recursive         bool
+	fetchModules      bool
+	concurrency       int
+	warnInaccurate    bool
+	compactUnknown    bool
+	assumeChanged     bool
+
+	webhook         string
+	webhookHeaders  []string
+	webhookRequired bool
+
+	noTargetTypes []string
+	maxTargets    int
+	files         []string
+	emptyOutput   string
+	preCommand    string
+
+	onlyAttributes []string
+	outputs        bool
+	stateJSON      string
+	defaultsFile   string
+	defaults       map[string]map[string]cty.Value
+
+	dataSources            string
+	ignoreComputed         []string
+	ignoreMoves            bool
+	ignoreProviderVersions bool
+	batches                bool
+
+	relativeTo     string
+	relativeModule string
+
+	ignoreWhitespace bool
+	canonicalizeJSON bool
+	missingAsDefault bool
 
-type Block struct {
-	Attributes map[string]cty.Value
-	Blocks     map[string]Block
+	maxHistory     int
+	outputTemplate string
+	allowedFile    string
+
+	fetch bool
+	noGit bool
+	dirs  []string
+
+	replaceTypes      []string
+	replaceAttributes []string
+
+	normalizerFuncs []tfdiff.Normalizer
+
+	configFile string
+	profile    string
+
+	autoFull bool
+	fullPlan bool
+
+	sinceDeploy  bool
+	deployMarker string
+
+	fileRenames map[string]string
+
+	env string
+
+	setBlocks []string
+
+	cloneTimeout time.Duration
+	parseTimeout time.Duration
 }
 
 func main() {
+	opts := &options{}
+
 	rootCmd := &cobra.Command{
+		Use:   "tfdiff",
+		Short: "Print the terraform -target options for the resources changed since a base revision",
+		Long: `Print the terraform -target options for the resources changed since a base revision.
+
+The addresses are quoted for a shell, so the output can be pasted into one
+or passed on with eval "terraform plan $(tfdiff)". --format args prints one
+unquoted option per line for terraform plan $(tfdiff --format args).
+
+Exit status is 0 on success and 1 on errors. With --exit-code, like
+git diff --exit-code, it's 0 when nothing differs, 1 when anything does and
+2 on errors.`,
+		Args: func(c *cobra.Command, args []string) error {
+			if opts.noGit {
+				return cobra.ExactArgs(2)(c, args)
+			}
+			return cobra.NoArgs(c, args)
+		},
+		PersistentPreRun: func(c *cobra.Command, args []string) {
+			if opts.profile != "" {
+				if err := applyProfile(c, configPath(opts), opts.profile); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+			if opts.env != "" {
+				if err := resolveEnv(opts); err != nil {
+					fmt.Fprintln(os.Stderr, err)
+					os.Exit(1)
+				}
+			}
+		},
 		Run: func(c *cobra.Command, args []string) {
-			baseBranch, err := c.PersistentFlags().GetString("base")
+			opts.dirs = args
+			err := diff(opts)
+			removeTempDirs()
+			if opts.stats {
+				stats.print(os.Stderr)
+			}
+			if err == errChanged {
+				os.Exit(1)
+			}
+			if err == errDiffers {
+				os.Exit(1)
+			}
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(os.Stderr, err)
+				if opts.exitCode {
+					os.Exit(2)
+				}
 				os.Exit(1)
 			}
+		},
+	}
 
-			err = diff(baseBranch)
+	rootCmd.PersistentFlags().StringVar(&opts.configFile, "config", defaultConfigFile, "config file to read --profile and env_path from, relative to --chdir if given")
+	rootCmd.PersistentFlags().StringVar(&opts.profile, "profile", "", "set the flags of this profile in the config file that aren't given on the command line")
+	rootCmd.PersistentFlags().StringVarP(&opts.chdir, "chdir", "C", "", "run as if started in this directory, like git -C, without changing the working directory of the process")
+	rootCmd.PersistentFlags().StringVar(&opts.env, "env", "", "compare the directory of this environment, found through env_path in the config file (default \"envs/{env}\")")
+	rootCmd.PersistentFlags().StringVarP(&opts.base, "base", "b", "", "base branch, tag or revision (e.g. HEAD~1), optionally with the base directory as ref:path (e.g. main:environments/prod); defaults to the upstream of the current branch, then main or master")
+	rootCmd.PersistentFlags().StringVar(&opts.baseWorktree, "base-worktree", "", "read the base side from an existing git worktree instead of cloning")
+	rootCmd.PersistentFlags().StringVar(&opts.baseRepo, "base-repo", "", "clone the base side from this repository (URL or path) instead of the current one")
+	rootCmd.PersistentFlags().StringVar(&opts.baseArchive, "base-archive", "", "read the base side from this .tar.gz, .tgz or .zip of the repository instead of git")
+	rootCmd.PersistentFlags().StringVar(&opts.basePath, "base-path", "", "directory of the base side, relative to its repository root (default: the current directory's)")
+	rootCmd.PersistentFlags().StringVar(&opts.format, "format", "plain", "output format (plain, args, json, target-file, tree, csv, junit, oneline, hcl, import, sarif, markdown, summary)")
+	rootCmd.PersistentFlags().StringVar(&opts.preCommand, "pre-command", "", "shell command run in the current directory of both trees before reading them (e.g. \"make generate\")")
+	rootCmd.PersistentFlags().StringVar(&opts.outputTemplate, "output-template", "", "format the output with the Go text/template in this file instead of --format (see templates/)")
+	rootCmd.PersistentFlags().StringVar(&opts.emptyOutput, "empty-output", "-refresh=false", "what to print in plain format when nothing differs (empty prints nothing)")
+	rootCmd.PersistentFlags().BoolVar(&opts.summary, "summary", false, "also print a human-readable summary to stderr")
+	rootCmd.PersistentFlags().BoolVar(&opts.summary, "summary-stderr", false, "same as --summary")
+	rootCmd.PersistentFlags().BoolVar(&opts.explain, "explain", false, "also print why each target is emitted to stderr")
+	rootCmd.PersistentFlags().BoolVar(&opts.full, "full", false, "report every differing resource, not only those defined in files changed since the base, referring to those, or using variables, locals or files that changed")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.vars, "var", nil, "set a root module variable on both sides, like terraform -var (NAME=VALUE, repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&opts.strict, "strict", false, "fail instead of warning when no terraform files are found")
+	rootCmd.PersistentFlags().BoolVar(&opts.stats, "stats", false, "print the time spent cloning, reading, parsing and diffing, and what was processed, to stderr")
+	rootCmd.PersistentFlags().BoolVar(&opts.exitCode, "exit-code", false, "exit with 1 when anything differs and 0 otherwise, like git diff --exit-code (errors exit with 2)")
+	rootCmd.PersistentFlags().StringVar(&opts.only, "only", "", "report only whether this resource address changed, exiting 1 if it did")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.files, "files", nil, "only compare resources defined in these files of the current directory")
+	rootCmd.PersistentFlags().BoolVar(&opts.outputs, "outputs", false, "also report changed output blocks as output.NAME (never emitted as -target)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.onlyAttributes, "only-attribute", nil, "only report resources where this attribute path changed, e.g. instance_type (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.ignoreFiles, "ignore-file", nil, "ignore resources defined in files matching this pattern (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&opts.scope, "scope", "", "only diff this module (e.g. module.network), its instances and its descendants")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.excludePaths, "exclude-path", nil, "ignore resources defined in files under this repo-relative path or pattern (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.exclude, "exclude", nil, "don't read files under this repo-relative path or pattern on either side, such as examples, relative to --chdir when given (repeatable; wins over --include)")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.include, "include", nil, "only read the files of the compared directory under this repo-relative path or pattern, relative to --chdir when given (repeatable; modules are still read)")
+	rootCmd.PersistentFlags().StringVar(&opts.defaultsFile, "defaults-file", "", "JSON file mapping \"type.attribute\" to provider default values that aren't a change when added or removed")
+	rootCmd.PersistentFlags().StringArrayVar(&opts.ignoreComputed, "ignore-computed", nil, "ignore attributes whose name matches this pattern, such as *_arn, at any level (repeatable)")
+	rootCmd.PersistentFlags().BoolVar(&opts.ignoreMoves, "ignore-moved-noise", false, "hide relocations without moved blocks: renames with identical content and moved module directories")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.normalizers, "normalize", nil, "transforms applied to resources before comparing them: "+strings.Join(tfdiff.NormalizerNames(), ", "))
+	rootCmd.PersistentFlags().BoolVar(&opts.ignoreProviderVersions, "ignore-provider-versions", false, "only warn about required_providers changes confined to version constraints instead of falling back to a full plan")
+	rootCmd.PersistentFlags().BoolVar(&opts.ignoreWhitespace, "ignore-whitespace-in-strings", false, "compare JSON strings by their canonical form and other strings with whitespace collapsed (hides whitespace changes)")
+	rootCmd.PersistentFlags().BoolVar(&opts.canonicalizeJSON, "canonicalize-json", false, "compare strings holding JSON, such as policies, with their keys sorted and whitespace removed")
+	rootCmd.PersistentFlags().BoolVar(&opts.missingAsDefault, "treat-missing-as-default", false, "treat an object key missing on one side as equal to a null or empty value on the other")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.setBlocks, "set-blocks", nil, "TYPE.BLOCK nested blocks compared regardless of order, like the built-in aws_security_group.ingress")
+	rootCmd.PersistentFlags().BoolVar(&opts.ignoreOrder, "ignore-order", false, "compare list attributes ignoring element order (hides order-significant changes)")
+	rootCmd.PersistentFlags().BoolVarP(&opts.recursive, "recursive", "r", false, "also read the .tf and .tf.json files of subdirectories, except hidden ones such as .terraform; those of local modules are compared under the module calls, and separate root modules, such as envs/dev next to envs/prod, are skipped with a warning")
+	rootCmd.PersistentFlags().BoolVar(&opts.noModuleRecursion, "no-module-recursion", false, "compare module calls by their arguments only, without reading local module sources")
+	rootCmd.PersistentFlags().BoolVar(&opts.assumeChanged, "assume-changed-on-unknown", false, "report resources with values that can't be evaluated statically as changed")
+	rootCmd.PersistentFlags().BoolVar(&opts.warnInaccurate, "warn-inaccurate", false, "warn about resources using constructs that can't be evaluated statically (references, dynamic blocks, functions)")
+	rootCmd.PersistentFlags().BoolVar(&opts.compactUnknown, "compact-unknown", false, "like --warn-inaccurate, but with a single summary of the resources at the end")
+	rootCmd.PersistentFlags().IntVar(&opts.concurrency, "concurrency", runtime.GOMAXPROCS(0), "number of files to parse in parallel")
+	rootCmd.PersistentFlags().BoolVar(&opts.fetchModules, "fetch-modules", false, "download registry modules pinned to an exact version and compare their resources")
+	rootCmd.PersistentFlags().BoolVar(&opts.noRetry, "no-retry", false, "don't retry failed clones of the base branch")
+	rootCmd.PersistentFlags().DurationVar(&opts.cloneTimeout, "clone-timeout", 0, "fail when cloning or fetching the base takes longer than this, e.g. 2m, retries included (0 for no limit)")
+	rootCmd.PersistentFlags().DurationVar(&opts.parseTimeout, "parse-timeout", 0, "fail when parsing either side takes longer than this, e.g. 30s (0 for no limit)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.noTargetTypes, "no-target-types", nil, "resource types to report but never emit as -target (e.g. null_resource,terraform_data)")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.replaceTypes, "replace-types", nil, "resource types whose changed resources are also emitted as -replace, to force their recreation")
+	rootCmd.PersistentFlags().StringSliceVar(&opts.replaceAttributes, "replace-attributes", nil, "TYPE.ATTRIBUTE paths (e.g. aws_instance.ami) whose change emits the resource as -replace too")
+	rootCmd.PersistentFlags().StringVar(&opts.dataSources, "data-sources", "target", "changed data sources: target reports and targets them and the resources reading them, dependents reports them but only targets the readers, off leaves them out")
+	rootCmd.PersistentFlags().StringVar(&opts.relativeTo, "relative-to", "", "rewrite targets for a terraform invocation in this module directory")
+	rootCmd.PersistentFlags().BoolVar(&opts.batches, "batches", false, "split targets into batches to apply in sequence, dependencies first (one line each in plain format)")
+	rootCmd.PersistentFlags().IntVar(&opts.maxTargets, "max-targets", 50, "fall back to a full plan when more resources than this differ (0 for no limit)")
+	rootCmd.PersistentFlags().BoolVar(&opts.autoFull, "auto-full", false, "also fall back to a full plan when targeting may miss changes, instead of only recommending one")
+	rootCmd.Flags().StringVar(&opts.webhook, "webhook", "", "POST the JSON result to this URL")
+	rootCmd.Flags().StringArrayVar(&opts.webhookHeaders, "webhook-header", nil, "extra header for the webhook request, as \"Name: value\" (repeatable)")
+	rootCmd.Flags().BoolVar(&opts.webhookRequired, "webhook-required", false, "fail when the webhook request fails")
+	rootCmd.Flags().IntVar(&opts.maxHistory, "max-history", 0, "with --per-commit, walk at most this many commits of history (0 for no limit)")
+	rootCmd.Flags().BoolVar(&opts.perCommit, "per-commit", false, "report the resources changed by each commit between the base and HEAD")
+	rootCmd.Flags().StringVar(&opts.stateJSON, "state-json", "", "compare against the resources in this terraform show -json output instead of a git ref")
+	rootCmd.Flags().StringVar(&opts.allowedFile, "allowed", "", "fail when a resource differs that no address or pattern in this file allows, one per line")
+	rootCmd.Flags().BoolVar(&opts.sinceDeploy, "since-deploy", false, "compare against the last deployed commit, marked by --deploy-marker")
+	rootCmd.Flags().StringVar(&opts.deployMarker, "deploy-marker", "deployed", "tag or ref of the last deployed commit, or else the text of a git note on it")
+	rootCmd.Flags().BoolVar(&opts.fetch, "fetch", false, "fetch the remote-tracking branch of the base (e.g. origin/main) from its remote first")
+	rootCmd.Flags().BoolVar(&opts.noGit, "no-git", false, "compare two directories given as arguments, base first, without git")
+	rootCmd.Flags().StringVar(&opts.baseline, "baseline", "", "compare against a snapshot file written by tfdiff snapshot instead of a git ref")
+	rootCmd.Flags().StringVar(&opts.baseline, "snapshot-base", "", "same as --baseline, for a snapshot saved by an earlier run with --snapshot-save")
+	rootCmd.Flags().StringVar(&opts.snapshotSave, "snapshot-save", "", "also write the resources of the working tree to this snapshot file, to compare later runs against")
+	rootCmd.Flags().StringVar(&opts.renamesFile, "renames", "", "file of \"OLD NEW\" address lines; base resources at OLD are compared with target resources at NEW")
+
+	rootCmd.RegisterFlagCompletionFunc("base", completeRefs)
+	rootCmd.RegisterFlagCompletionFunc("data-sources", func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"target", "dependents", "off"}, cobra.ShellCompDirectiveNoFileComp
+	})
+	rootCmd.RegisterFlagCompletionFunc("format", func(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{"plain", "args", "json", "target-file", "tree", "csv", "junit", "oneline", "hcl", "import", "sarif", "markdown", "summary"}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	var snapshotOutput string
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Write the resources of the working tree to a snapshot file",
+		Run: func(c *cobra.Command, args []string) {
+			err := snapshot(opts, snapshotOutput)
 			if err != nil {
-				fmt.Println(err)
+				fmt.Fprintln(os.Stderr, err)
 				os.Exit(1)
 			}
 		},
 	}
+	snapshotCmd.Flags().StringVarP(&snapshotOutput, "output", "o", "", "snapshot file (default stdout)")
+	rootCmd.AddCommand(snapshotCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "check-targetable",
+		Short: "Check that -target and -replace can express every change, failing with the changes they can't",
+		Run: func(c *cobra.Command, args []string) {
+			opts.checkTargetable = true
+			err := diff(opts)
+			removeTempDirs()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	})
 
-	rootCmd.PersistentFlags().StringP("base", "b", "", "base branch")
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "files",
+		Short: "List the files read from the working tree and, with a base given, the base side",
+		Run: func(c *cobra.Command, args []string) {
+			err := listFiles(os.Stdout, opts)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		},
+	})
 
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func diff(baseBranch string) error {
-	if baseBranch == "" {
-		_, err := exec.Command("sh", "-c", "git branch | grep -q main").Output()
-		if err == nil {
-			baseBranch = "main"
+// completeRefs completes --base with local branches and tags. cobra's
+// built-in completion command generates the shell scripts.
+func completeRefs(c *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	repo, err := git.PlainOpenWithOptions(".", &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	iter, err := repo.References()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var refs []string
+	iter.ForEach(func(r *plumbing.Reference) error {
+		if r.Name().IsBranch() || r.Name().IsTag() {
+			if ref := r.Name().Short(); strings.HasPrefix(ref, toComplete) {
+				refs = append(refs, ref)
+			}
 		}
+		return nil
+	})
+	sort.Strings(refs)
 
-		_, err = exec.Command("sh", "-c", "git branch | grep -q master").Output()
-		if err == nil {
-			baseBranch = "master"
+	return refs, cobra.ShellCompDirectiveNoFileComp
+}
+
+func diff(opts *options) error {
+	if err := parseVars(opts); err != nil {
+		return err
+	}
+
+	switch opts.dataSources {
+	case "", "target", "dependents", "off":
+	default:
+		return fmt.Errorf("unknown --data-sources %q (target, dependents or off)", opts.dataSources)
+	}
+
+	for _, name := range opts.normalizers {
+		n, ok := tfdiff.LookupNormalizer(name)
+		if !ok {
+			return fmt.Errorf("unknown normalizer %q (available: %s)", name, strings.Join(tfdiff.NormalizerNames(), ", "))
 		}
+		opts.normalizerFuncs = append(opts.normalizerFuncs, n)
+	}
 
-		if baseBranch == "" {
-			return fmt.Errorf("can't specify base branch")
+	if opts.defaultsFile != "" {
+		defaults, err := readDefaults(opts.defaultsFile)
+		if err != nil {
+			return err
 		}
+		opts.defaults = defaults
 	}
 
-	p, err := exec.Command("sh", "-c", "git rev-parse --show-prefix").Output()
-	if err != nil {
+	if err := splitBase(opts); err != nil {
 		return err
 	}
-	path := strings.TrimSpace(string(p))
 
-	// Get resources on the base branch
-	content, err := getContent(baseBranch, path)
-	if err != nil {
-		return err
+	if opts.sinceDeploy {
+		if err := deployBase(opts); err != nil {
+			return err
+		}
 	}
-	baseResources, err := parse(content)
-	if err != nil {
-		return err
+
+	if opts.fetch {
+		if err := fetchBase(opts); err != nil {
+			return err
+		}
 	}
 
-	// Get resources on the target branch
-	content, err = getContent("", path)
+	if opts.perCommit {
+		return diffPerCommit(os.Stdout, opts)
+	}
+
+	baseResources, targetResources, err := loadResources(opts)
 	if err != nil {
 		return err
 	}
-	targetResources, err := parse(content)
-	if err != nil {
+
+	if opts.snapshotSave != "" {
+		if err := writeSnapshot(targetResources, opts.snapshotSave); err != nil {
+			return err
+		}
+	}
+
+	opts.fileRenames = fileRenames(opts)
+
+	if opts.renamesFile != "" {
+		renames, err := readRenames(opts.renamesFile)
+		if err != nil {
+			return err
+		}
+		applyRenames(baseResources, renames)
+	}
+
+	// Nothing to compare usually means the wrong directory, which
+	// shouldn't look like a clean diff.
+	if opts.configFiles == 0 {
+		msg := "no terraform files found in the current directory on either side"
+		if opts.strict {
+			return errors.New(msg)
+		}
+		warn(msg)
+	}
+
+	filterResources(opts, baseResources)
+	filterResources(opts, targetResources)
+
+	differ := newDiffer(opts)
+
+	if opts.only != "" {
+		if opts.stateJSON != "" {
+			return fmt.Errorf("--only can't be used with --state-json, which doesn't compare attributes")
+		}
+		return reportOnly(os.Stdout, differ, opts.only, baseResources[opts.only], targetResources[opts.only])
+	}
+
+	start := time.Now()
+	var result tfdiff.DiffResult
+	if opts.stateJSON != "" {
+		result = diffState(baseResources, targetResources)
+	} else {
+		result = onlyAttributes(opts, differ, differ.Diff(baseResources, targetResources), baseResources, targetResources)
+	}
+	stats.since("diff", start)
+
+	if opts.stateJSON == "" {
+		applyDataSources(opts, &result, baseResources, targetResources)
+	}
+
+	if result, err = smartFilter(opts, result, baseResources, targetResources); err != nil {
 		return err
 	}
 
-	var differentResources []string
+	for _, w := range result.Warnings {
+		warn(w)
+	}
 
-	for name, _ := range baseResources {
-		if _, ok := targetResources[name]; !ok {
-			differentResources = append(differentResources, name)
-			continue
+	if opts.relativeTo != "" {
+		module, err := relativeModule(opts, opts.relativeTo, targetResources, baseResources)
+		if err != nil {
+			return err
 		}
+		opts.relativeModule = module
+	}
 
-		if !reflect.DeepEqual(baseResources[name], targetResources[name]) {
-			differentResources = append(differentResources, name)
+	checkTargeting(opts, result, baseResources, targetResources)
+
+	if opts.allowedFile != "" {
+		if err := checkAllowed(opts, result); err != nil {
+			return err
 		}
 	}
 
-	for name, _ := range targetResources {
-		if _, ok := baseResources[name]; !ok {
-			differentResources = append(differentResources, name)
+	if opts.checkTargetable {
+		return checkTargetable(os.Stdout, opts, result, baseResources, targetResources)
+	}
+
+	if opts.webhook != "" {
+		if err := postWebhook(opts, result); err != nil {
+			if opts.webhookRequired {
+				return err
+			}
+			warn(err.Error())
 		}
 	}
 
-	if len(differentResources) > 0 {
-		for _, r := range differentResources {
-			fmt.Printf("-target %s ", r)
+	// Only the targets go to stdout, so they can be passed to terraform
+	// with eval "terraform plan $(tfdiff)", or $(tfdiff --format args).
+	if opts.summary {
+		if err := printSummary(os.Stderr, result); err != nil {
+			return err
 		}
-	} else {
-		fmt.Print("-refresh=false")
+	}
+	if opts.explain {
+		printExplanation(os.Stderr, opts, result, baseResources, targetResources)
 	}
 
+	if err := writeOutput(os.Stdout, opts, result, baseResources, targetResources); err != nil {
+		return err
+	}
+
+	if opts.compactUnknown {
+		summarizeInaccurate(baseResources, targetResources)
+	}
+
+	if opts.exitCode && (len(result.Targets()) > 0 || result.BackendChanged || result.ProvidersChanged) {
+		return errDiffers
+	}
 	return nil
 }
 
-func getContent(baseBranch, path string) ([]byte, error) {
-	var buf bytes.Buffer
+// parseVars splits the --var NAME=VALUE arguments.
+func parseVars(opts *options) error {
+	if len(opts.vars) == 0 {
+		return nil
+	}
 
-	if baseBranch == "" {
-		files, err := filepath.Glob("*.tf")
-		if err != nil {
-			return nil, err
+	opts.overrides = make(map[string]string)
+	for _, v := range opts.vars {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return fmt.Errorf("invalid --var %q: expected NAME=VALUE", v)
 		}
+		opts.overrides[kv[0]] = kv[1]
+	}
+	return nil
+}
 
-		for _, f := range files {
-			c, err := ioutil.ReadFile(f)
+func loadResources(opts *options) (map[string]*tfdiff.Resource, map[string]*tfdiff.Resource, error) {
+	if opts.noGit {
+		var sides []map[string]*tfdiff.Resource
+		for _, dir := range opts.dirs {
+			if _, err := os.Stat(dir); err != nil {
+				return nil, nil, err
+			}
+			resources, err := parseDir(opts, osfs.New(dir), "")
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			buf.Write(c)
+			sides = append(sides, resources)
+		}
+		return sides[0], sides[1], nil
+	}
+
+	if opts.baseline != "" || opts.stateJSON != "" {
+		read := readSnapshot
+		filename := opts.baseline
+		if opts.stateJSON != "" {
+			read, filename = readState, opts.stateJSON
+		}
+
+		baseResources, err := read(filename)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		targetResources, err := localResources(opts)
+		if err != nil {
+			return nil, nil, err
 		}
+
+		return baseResources, targetResources, nil
+	}
+
+	path, err := showPrefix(opts)
+	if err != nil {
+		// an archive base doesn't need a repository, like localResources
+		if opts.baseArchive == "" {
+			return nil, nil, err
+		}
+		path = ""
+	}
+
+	basePath := basePrefix(opts, path)
+
+	// Getting the base side usually means a clone, so the target side is
+	// parsed meanwhile. Pre-commands aren't run side by side, though.
+	type content struct {
+		fs  billy.Filesystem
+		err error
+	}
+	base := make(chan content, 1)
+	fetch := func() {
+		fs, err := baseContent(opts, basePath)
+		base <- content{fs, err}
+	}
+	if opts.preCommand != "" {
+		fetch()
 	} else {
-		r, err := exec.Command("sh", "-c", "git rev-parse --show-toplevel").Output()
+		go fetch()
+	}
+
+	var targetResources map[string]*tfdiff.Resource
+	var targetWarnings []string
+	fs, err := getContent(opts, "", path)
+	if err == nil {
+		targetResources, targetWarnings, err = parseFiles(opts, fs, path)
+	}
+
+	// the base side fails first, as it did when the sides ran in turn
+	b := <-base
+	if b.err != nil {
+		return nil, nil, b.err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	baseResources, err := parseDir(opts, b.fs, basePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, w := range targetWarnings {
+		warn(w)
+	}
+
+	return baseResources, targetResources, nil
+}
+
+// baseContent returns the filesystem holding the base side: an existing
+// worktree when --base-worktree is given, otherwise a clone of the base ref.
+func baseContent(opts *options, path string) (billy.Filesystem, error) {
+	if opts.baseArchive != "" {
+		if opts.base != "" || opts.baseRepo != "" || opts.baseWorktree != "" {
+			return nil, fmt.Errorf("--base-archive can't be used with --base, --base-repo or --base-worktree")
+		}
+
+		fs, err := readArchive(opts.baseArchive)
 		if err != nil {
 			return nil, err
 		}
-		root := strings.TrimSpace(string(r))
+		if opts.preCommand != "" {
+			return generateCopy(opts, fs, path)
+		}
+		return fs, nil
+	}
 
-		storer := memory.NewStorage()
-		fs := memfs.New()
+	if opts.baseWorktree != "" {
+		if opts.base != "" {
+			return nil, fmt.Errorf("--base and --base-worktree can't be used together")
+		}
+		if opts.baseRepo != "" {
+			return nil, fmt.Errorf("--base-repo and --base-worktree can't be used together")
+		}
 
-		repo, err := git.Clone(storer, fs, &git.CloneOptions{
-			URL: root,
-		})
-		if err != nil {
+		if _, err := os.Stat(opts.baseWorktree); err != nil {
 			return nil, err
 		}
 
-		w, err := repo.Worktree()
+		root := opts.baseWorktree
+		if r, err := exec.Command("git", "-C", root, "rev-parse", "--show-toplevel").Output(); err == nil {
+			root = strings.TrimSpace(string(r))
+		}
+		if opts.preCommand != "" {
+			return generateCopy(opts, osfs.New(root), path)
+		}
+		return osfs.New(root), nil
+	}
+
+	if opts.baseRepo != "" {
+		ref := opts.base
+		if ref == "" {
+			ref = "HEAD"
+		}
+
+		repo, fs, err := cloneURL(opts, opts.baseRepo, ref)
 		if err != nil {
 			return nil, err
 		}
+		if err := checkoutRevision(repo, ref); err != nil {
+			return nil, err
+		}
+		if opts.preCommand != "" {
+			return generateCopy(opts, fs, path)
+		}
+		return fs, nil
+	}
+
+	baseBranch, err := baseRef(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return getContent(opts, baseBranch, path)
+}
+
+func baseRef(opts *options) (string, error) {
+	if opts.base != "" {
+		return opts.base, nil
+	}
+
+	// The upstream is resolved to a commit here, since the clone only
+	// knows it under a different remote-tracking name.
+	if u, err := gitCommand(opts, "rev-parse", "--verify", "--quiet", "@{upstream}").Output(); err == nil {
+		return strings.TrimSpace(string(u)), nil
+	}
+
+	repo, err := git.PlainOpenWithOptions(workDir(opts), &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return "", fmt.Errorf("can't specify base branch: %s", err)
+	}
+
+	for _, name := range []string{"main", "master"} {
+		if _, err := repo.Reference(plumbing.NewBranchReferenceName(name), false); err == nil {
+			return name, nil
+		}
+	}
+
+	// Otherwise the default branch of origin, or the branch HEAD is on.
+	if ref, err := repo.Reference(plumbing.NewRemoteHEADReferenceName("origin"), true); err == nil {
+		return ref.Hash().String(), nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("can't specify base branch: %s", err)
+	}
+	if head.Name().IsBranch() {
+		return head.Name().Short(), nil
+	}
+	return head.Hash().String(), nil
+}
+
+// fetchBase updates the remote-tracking branch the base refers to, --base
+// or the upstream of the current branch, from its remote.
+func fetchBase(opts *options) error {
+	ref := opts.base
+	if ref == "" {
+		u, err := gitCommand(opts, "rev-parse", "--abbrev-ref", "--symbolic-full-name", "@{upstream}").Output()
+		if err != nil {
+			return fmt.Errorf("--fetch: the current branch has no upstream; give --base")
+		}
+		ref = strings.TrimSpace(string(u))
+	}
 
-		err = w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(baseBranch)})
+	out, err := gitCommand(opts, "remote").Output()
+	if err != nil {
+		return err
+	}
+	for _, remote := range strings.Fields(string(out)) {
+		if !strings.HasPrefix(ref, remote+"/") {
+			continue
+		}
+		ctx, cancel := stageContext(opts.cloneTimeout)
+		cmd := exec.CommandContext(ctx, "git", "fetch", "--quiet", remote, strings.TrimPrefix(ref, remote+"/"))
+		cmd.Dir = opts.chdir
+		out, err := cmd.CombinedOutput()
+		timedOut := ctx.Err() != nil
+		cancel()
+		if timedOut {
+			return fmt.Errorf("git fetch %s timed out after %s (--clone-timeout)", remote, opts.cloneTimeout)
+		}
+		if err != nil {
+			return fmt.Errorf("git fetch %s: %s", remote, strings.TrimSpace(string(out)))
+		}
 
-		files, err := util.Glob(fs, fmt.Sprintf("%s*.tf", path))
+		// In the clone, origin/NAME is the local branch NAME, so the base
+		// is given as the fetched commit.
+		hash, err := gitCommand(opts, "rev-parse", "--verify", "refs/remotes/"+ref).Output()
 		if err != nil {
-			return nil, err
+			return fmt.Errorf("--fetch: %s: %s", ref, err)
 		}
+		opts.base = strings.TrimSpace(string(hash))
+		return nil
+	}
 
-		for _, f := range files {
-			c, err := util.ReadFile(fs, f)
-			if err != nil {
-				return nil, err
+	warn(fmt.Sprintf("--fetch: %s isn't a remote-tracking branch, so nothing is fetched", ref))
+	return nil
+}
+
+// deployBase sets the base to the last deployed commit: the one
+// --deploy-marker names as a tag or other ref, or else the most recent
+// commit of HEAD's history with a git note holding the marker as a line.
+func deployBase(opts *options) error {
+	if opts.base != "" {
+		return fmt.Errorf("--since-deploy can't be used with --base")
+	}
+
+	if hash, err := gitCommand(opts, "rev-parse", "--verify", "--quiet", opts.deployMarker+"^{commit}").Output(); err == nil {
+		opts.base = strings.TrimSpace(string(hash))
+		return nil
+	}
+
+	out, err := gitCommand(opts, "log", "--notes", "--format=%H%n%N%x00", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("--since-deploy: git log: %s", err)
+	}
+	for _, entry := range strings.Split(string(out), "\x00") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		for _, line := range lines[1:] {
+			if strings.TrimSpace(line) == opts.deployMarker {
+				opts.base = lines[0]
+				return nil
 			}
-			buf.Write(c)
 		}
 	}
 
-	return buf.Bytes(), nil
+	return fmt.Errorf("--since-deploy: no ref or git note marks a commit as %q", opts.deployMarker)
 }
 
-func parse(content []byte) (map[string]*Resource, error) {
-	resources := make(map[string]*Resource)
-	parser := hclparse.NewParser()
-	file, parseDiags := parser.ParseHCL(content, "")
-	if parseDiags.HasErrors() {
-		return nil, fmt.Errorf(parseDiags.Error())
+// splitBase splits a --base of the form ref:path, like git's, into the
+// ref and --base-path.
+func splitBase(opts *options) error {
+	i := strings.Index(opts.base, ":")
+	if i < 0 {
+		return nil
+	}
+	if opts.basePath != "" {
+		return fmt.Errorf("--base %s: the path can't be combined with --base-path", opts.base)
 	}
 
-	for _, block := range reflect.ValueOf(file.Body).Elem().Interface().(hclsyntax.Body).Blocks {
-		if block.Type == "resource" || block.Type == "module" {
-			resource := decodeResource(block)
-			resources[resource.Name] = resource
+	ref, path := opts.base[:i], opts.base[i+1:]
+	if ref == "" {
+		return fmt.Errorf("--base %s: no ref before the colon", opts.base)
+	}
+	opts.base = ref
+	if path == "" {
+		path = "."
+	}
+	opts.basePath = path
+	return nil
+}
+
+// basePrefix returns the directory of the base side, path unless
+// --base-path is given.
+func basePrefix(opts *options, path string) string {
+	if opts.basePath == "" {
+		return path
+	}
+	basePath := pathpkg.Clean(strings.Trim(opts.basePath, "/")) + "/"
+	if basePath == "./" {
+		return ""
+	}
+	return basePath
+}
+
+// gitCommand runs git in the --chdir directory, or the current one.
+func gitCommand(opts *options, args ...string) *exec.Cmd {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = opts.chdir
+	return cmd
+}
+
+// workDir returns the directory the local side is read from.
+func workDir(opts *options) string {
+	if opts.chdir == "" {
+		return "."
+	}
+	return opts.chdir
+}
+
+func showPrefix(opts *options) (string, error) {
+	p, err := gitCommand(opts, "rev-parse", "--show-prefix").Output()
+	if err != nil {
+		if e, ok := err.(*exec.ExitError); ok && len(e.Stderr) > 0 {
+			err = errors.New(strings.TrimSpace(string(e.Stderr)))
 		}
+		return "", fmt.Errorf("finding the directory within the repository: %s", err)
+	}
+	return strings.TrimSpace(string(p)), nil
+}
+
+// localResources parses the working tree without requiring a git
+// repository. Inside one, file names are still made repo-relative.
+func localResources(opts *options) (map[string]*tfdiff.Resource, error) {
+	path := ""
+	if p, err := gitCommand(opts, "rev-parse", "--show-prefix").Output(); err == nil {
+		path = strings.TrimSpace(string(p))
+	}
+
+	fs, err := getContent(opts, "", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseDir(opts, fs, path)
+}
+
+func newDiffer(opts *options) *tfdiff.Differ {
+	return &tfdiff.Differ{
+		IgnoreOrder:            opts.ignoreOrder,
+		Defaults:               opts.defaults,
+		AssumeChangedOnUnknown: opts.assumeChanged,
+		IgnoreAttributes:       opts.ignoreComputed,
+		IgnoreMoves:            opts.ignoreMoves,
+		IgnoreProviderVersions: opts.ignoreProviderVersions,
+		IgnoreWhitespace:       opts.ignoreWhitespace,
+		CanonicalizeJSON:       opts.canonicalizeJSON,
+		MissingAsDefault:       opts.missingAsDefault,
+		Normalizers:            opts.normalizerFuncs,
+	}
+}
+
+func parseDir(opts *options, fs billy.Filesystem, path string) (map[string]*tfdiff.Resource, error) {
+	resources, warnings, err := parseFiles(opts, fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, w := range warnings {
+		warn(w)
 	}
 
 	return resources, nil
 }
 
-func decodeResource(block *hclsyntax.Block) *Resource {
-	r := &Resource{}
+// parseFiles is parseDir leaving the warnings to the caller.
+func parseFiles(opts *options, fs billy.Filesystem, path string) (map[string]*tfdiff.Resource, []string, error) {
+	exclude, include := opts.exclude, opts.include
+	if opts.chdir != "" {
+		exclude, include = rebasePatterns(exclude, path), rebasePatterns(include, path)
+	}
 
-	if block.Type == "resource" {
-		r.Name = fmt.Sprintf("%s.%s", block.Labels[0], block.Labels[1])
-	} else if block.Type == "module" {
-		r.Name = fmt.Sprintf("module.%s", block.Labels[0])
+	read := func(dir string) ([]tfdiff.File, error) {
+		files, err := readFiles(fs, dir)
+		if len(exclude) > 0 {
+			files = filterFiles(files, exclude, false)
+		}
+		for _, f := range files {
+			opts.filesRead = append(opts.filesRead, f.Name)
+		}
+		return files, err
+	}
+
+	var files []tfdiff.File
+	var roots []string
+	var err error
+	if opts.recursive {
+		files, err = tfdiff.ReadTree(fs, path, read)
+		if err == nil {
+			files, roots = rootFiles(files, path)
+		}
+	} else {
+		files, err = read(path)
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+	if len(include) > 0 {
+		files = filterFiles(files, include, true)
+	}
+	opts.configFiles += len(files)
 
-	if len(block.Body.Attributes) > 0 {
-		r.Attributes = decodeAttributes(block.Body.Attributes)
+	p := &tfdiff.Parser{Variables: tfdiff.EnvVariables(), Overrides: opts.overrides, Concurrency: opts.concurrency, WarnInaccurate: opts.warnInaccurate && !opts.compactUnknown, TrackInaccurate: opts.compactUnknown, Outputs: opts.outputs, SetBlocks: opts.setBlocks}
+	if opts.fetchModules && !opts.noModuleRecursion {
+		p.FetchModule = fetchModule
+	}
+	for _, f := range opts.files {
+		p.Scope = append(p.Scope, path+f)
+	}
+	if !opts.noModuleRecursion {
+		p.LoadModule = func(dir string) ([]tfdiff.File, error) {
+			if dir == "." {
+				return read("")
+			}
+			return read(dir + "/")
+		}
 	}
 
-	if len(block.Body.Blocks) > 0 {
-		r.Blocks = decodeBlocks(block.Body.Blocks)
+	// module files are read while parsing
+	start, readTime := time.Now(), stats.get("read")
+	resources, err := parseWithTimeout(opts, p, files)
+	stats.add("parse", time.Since(start)-(stats.get("read")-readTime))
+	if err != nil {
+		return nil, nil, err
 	}
+	stats.count(0, len(resources))
 
-	return r
+	warnings := p.Warnings
+	for _, dir := range roots {
+		warnings = append(warnings, fmt.Sprintf("--recursive: %s is skipped, as it's a separate root module rather than a module called from the compared directory; compare it on its own with --chdir", dir))
+	}
+	return resources, warnings, nil
 }
 
-func decodeAttributes(attributes hclsyntax.Attributes) map[string]cty.Value {
-	a := make(map[string]cty.Value)
+// The same warning usually comes up for both the base and the target side,
+// so each one is only printed once.
+func warn(msg string) {
+	if warned[msg] {
+		return
+	}
+	warned[msg] = true
+	fmt.Fprintf(os.Stderr, "warning: %s\n", msg)
+}
 
-	for _, attr := range attributes {
-		v, _ := attr.Expr.Value(&hcl.EvalContext{})
-		a[attr.Name] = v
+// summarizeInaccurate warns once about the resources of either side using
+// constructs that can't be evaluated statically.
+func summarizeInaccurate(baseResources, targetResources map[string]*tfdiff.Resource) {
+	seen := make(map[string]bool)
+	var names []string
+	for _, resources := range []map[string]*tfdiff.Resource{targetResources, baseResources} {
+		for name, r := range resources {
+			if len(r.Inaccuracies()) > 0 && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if len(names) == 0 {
+		return
 	}
+	sort.Strings(names)
 
-	return a
+	subject := fmt.Sprintf("%d resources contain", len(names))
+	if len(names) == 1 {
+		subject = "1 resource contains"
+	}
+	warn(fmt.Sprintf("%s unresolvable expressions; their diffs may be approximate: %s", subject, strings.Join(names, ", ")))
 }
 
-func decodeBlocks(blocks hclsyntax.Blocks) map[string]Block {
-	block := make(map[string]Block)
+func filterResources(opts *options, resources map[string]*tfdiff.Resource) {
+	if len(opts.ignoreFiles) > 0 {
+		ignoreFiles(resources, opts.ignoreFiles)
+	}
+	if len(opts.excludePaths) > 0 {
+		excludePaths(resources, opts.excludePaths)
+	}
+	if opts.scope != "" {
+		scopeResources(resources, opts.scope)
+	}
+}
 
-	for _, b := range blocks {
-		n := Block{}
-		if len(b.Body.Attributes) > 0 {
-			n.Attributes = decodeAttributes(b.Body.Attributes)
+// scopeResources keeps module, its instances and everything below them. The
+// terraform block settings are kept, since changes to them affect every
+// module.
+func scopeResources(resources map[string]*tfdiff.Resource, module string) {
+	for name, _ := range resources {
+		if name == module || strings.HasPrefix(name, module+".") || strings.HasPrefix(name, module+"[") || tfdiff.IsSetting(name) {
+			continue
 		}
+		delete(resources, name)
+	}
+}
+
+// onlyAttributes keeps the resources where one of the --only-attribute paths,
+// or anything below it, changed.
+func onlyAttributes(opts *options, differ *tfdiff.Differ, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) tfdiff.DiffResult {
+	if len(opts.onlyAttributes) == 0 {
+		return result
+	}
 
-		if len(b.Body.Blocks) > 0 {
-			n.Blocks = decodeBlocks(b.Body.Blocks)
+	keep := func(addresses []string) []string {
+		var kept []string
+		for _, address := range addresses {
+			if changesAttribute(differ.AttributeChanges(baseResources[address], targetResources[address]), opts.onlyAttributes) {
+				kept = append(kept, address)
+			}
 		}
+		return kept
+	}
+	result.Added = keep(result.Added)
+	result.Modified = keep(result.Modified)
+	result.Removed = keep(result.Removed)
+
+	return result
+}
 
-		block[b.Type] = n
+func changesAttribute(changes, paths []string) bool {
+	for _, c := range changes {
+		for _, p := range paths {
+			if c == p || strings.HasPrefix(c, p+".") || strings.HasPrefix(c, p+"[") {
+				return true
+			}
+		}
 	}
+	return false
+}
+
+// ignoreFiles drops resources whose defining file matches one of the
+// patterns, so changes in those files never influence the output.
+func ignoreFiles(resources map[string]*tfdiff.Resource, patterns []string) {
+	for name, r := range resources {
+		if matchFile(r.File, patterns) {
+			delete(resources, name)
+		}
+	}
+}
+
+func matchFile(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if ok, _ := pathpkg.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := pathpkg.Match(p, pathpkg.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// excludePaths drops resources whose repo-relative file path, or one of its
+// parent directories, matches one of the patterns.
+func excludePaths(resources map[string]*tfdiff.Resource, patterns []string) {
+	for name, r := range resources {
+		if matchPath(r.File, patterns) {
+			delete(resources, name)
+		}
+	}
+}
+
+// filterFiles keeps the files of a path matching patterns, or those not
+// matching when keep is false.
+func filterFiles(files []tfdiff.File, patterns []string, keep bool) []tfdiff.File {
+	var kept []tfdiff.File
+	for _, f := range files {
+		if matchPath(f.Name, patterns) == keep {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// rebasePatterns makes patterns relative to the directory path, for
+// --chdir, relative to the repository root like the file names.
+func rebasePatterns(patterns []string, path string) []string {
+	var rebased []string
+	for _, p := range patterns {
+		rebased = append(rebased, path+strings.TrimPrefix(p, "./"))
+	}
+	return rebased
+}
+
+func matchPath(name string, patterns []string) bool {
+	for _, p := range patterns {
+		p = strings.TrimSuffix(p, "/")
+		for dir := name; dir != "." && dir != "/"; dir = pathpkg.Dir(dir) {
+			if ok, _ := pathpkg.Match(p, dir); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getContent returns the filesystem holding the base branch, or the working
+// tree when baseBranch is empty. Both are rooted at the top of the repository
+// so paths resolve identically on either side.
+func getContent(opts *options, baseBranch, path string) (billy.Filesystem, error) {
+	if baseBranch == "" {
+		root := workDir(opts)
+		if r, err := gitCommand(opts, "rev-parse", "--show-toplevel").Output(); err == nil {
+			root = strings.TrimSpace(string(r))
+		}
+		if opts.preCommand != "" {
+			if err := runPreCommand(opts, filepath.Join(root, filepath.FromSlash(path))); err != nil {
+				return nil, err
+			}
+		}
+		return osfs.New(root), nil
+	}
+
+	repo, fs, err := cloneRepository(opts, baseBranch)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkoutRevision(repo, baseBranch); err != nil {
+		return nil, shallowError(opts, err)
+	}
+
+	if opts.preCommand != "" {
+		return generateCopy(opts, fs, path)
+	}
+	return fs, nil
+}
+
+// CI systems often make shallow clones, which may lack the base branch or
+// the history between it and HEAD.
+func shallowError(opts *options, err error) error {
+	out, e := gitCommand(opts, "rev-parse", "--is-shallow-repository").Output()
+	if e != nil || strings.TrimSpace(string(out)) != "true" {
+		return err
+	}
+	return fmt.Errorf("%s (the repository is a shallow clone; run git fetch --unshallow, or fetch the base branch, first)", err)
+}
+
+func cloneRepository(opts *options, ref string) (*git.Repository, billy.Filesystem, error) {
+	r, err := gitCommand(opts, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cloneURL(opts, strings.TrimSpace(string(r)), ref)
+}
 
-	return block
+// cloneURL clones url, a path or a remote repository, into memory.
+func cloneURL(opts *options, url, ref string) (*git.Repository, billy.Filesystem, error) {
+	defer stats.since("clone", time.Now())
+
+	ctx, cancel := stageContext(opts.cloneTimeout)
+	defer cancel()
+
+	var err error
+	attempts := cloneAttempts
+	if opts.noRetry {
+		attempts = 1
+	}
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(1<<uint(i-1)) * time.Second)
+		}
+
+		storer := memory.NewStorage()
+		fs := memfs.New()
+
+		var repo *git.Repository
+		repo, err = fetchRepository(ctx, storer, fs, url)
+		if err == nil {
+			return repo, fs, nil
+		}
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("cloning %s for base branch %s timed out after %s (--clone-timeout)", url, ref, opts.cloneTimeout)
+		}
+
+		if err == transport.ErrRepositoryNotFound || err == transport.ErrEmptyRemoteRepository {
+			break
+		}
+	}
+
+	return nil, nil, fmt.Errorf("failed to clone %s for base branch %s: %s", url, ref, err)
+}
+
+// cloneRefSpecs fetches what git.Clone would, plus HEAD, which may be
+// detached in CI, and remote-tracking branches such as the current branch's
+// upstream. Branches exist as origin/NAME and HEAD as origin/HEAD.
+var cloneRefSpecs = []config.RefSpec{
+	"+HEAD:refs/remotes/origin/HEAD",
+	"+refs/heads/*:refs/remotes/origin/*",
+	"+refs/tags/*:refs/tags/*",
+	"+refs/remotes/*:refs/remotes/tracking/*",
+}
+
+// git.Clone fails when the HEAD of the repository is detached, so the clone
+// is an initialized repository fetching from it instead.
+func fetchRepository(ctx context.Context, storer *memory.Storage, fs billy.Filesystem, url string) (*git.Repository, error) {
+	repo, err := git.Init(storer, fs)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: "origin", URLs: []string{url}}); err != nil {
+		return nil, err
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{RefSpecs: cloneRefSpecs, Tags: git.NoTags})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return nil, err
+	}
+
+	return repo, nil
+}
+
+// checkoutRevision checks out rev, which may be a branch, a tag, a commit
+// hash or any revision git understands. The errors tell a revision that
+// doesn't exist from one that can't be checked out.
+func checkoutRevision(repo *git.Repository, rev string) error {
+	defer stats.since("clone", time.Now())
+
+	w, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+
+	hash, err := tfdiff.ResolveRevision(repo, rev)
+	if err == nil {
+		if err := w.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+			return fmt.Errorf("can't check out %s (%s): %s", rev, hash, err)
+		}
+		return nil
+	}
+
+	if e := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName(rev)}); e != nil {
+		return fmt.Errorf("unknown revision %s (not a branch, tag or commit): %s", rev, err)
+	}
+	return nil
+}
+
+// readFiles is tfdiff.ReadFiles, timed and counted for --stats.
+func readFiles(fs billy.Filesystem, path string) ([]tfdiff.File, error) {
+	defer stats.since("read", time.Now())
+
+	files, err := tfdiff.ReadFiles(fs, path)
+	stats.count(len(files), 0)
+	return files, err
+}
+
+// rootFiles keeps the files of the compared directory path among those
+// --recursive read. The directories of local modules the files call are
+// read through the module calls, under their addresses. Any other
+// directory is a root module of its own, whose addresses would collide
+// with those of the compared one, so its files are left out and it's
+// returned among roots.
+func rootFiles(files []tfdiff.File, path string) (kept []tfdiff.File, roots []string) {
+	top := strings.TrimSuffix(path, "/")
+	if top == "" {
+		top = "."
+	}
+	sources := make(map[string]bool)
+	for _, dir := range tfdiff.ModuleSources(files) {
+		sources[dir] = true
+	}
+
+	seen := make(map[string]bool)
+	for _, f := range files {
+		dir := pathpkg.Dir(f.Name)
+		switch {
+		case dir == top:
+			kept = append(kept, f)
+		case !sources[dir] && !seen[dir]:
+			seen[dir] = true
+			roots = append(roots, dir)
+		}
+	}
+	return kept, roots
 }
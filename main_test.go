@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+func writeZip(t *testing.T, filename string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		fw, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadResourcesArchiveOutsideRepository(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(t.TempDir(), "base.zip")
+	writeZip(t, archive, map[string]string{"main.tf": `resource "a_b" "c" { x = 1 }`})
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.tf"), []byte(`resource "a_b" "c" { x = 2 }`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &options{chdir: dir, baseArchive: archive}
+	base, target, err := loadResources(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base["a_b.c"] == nil || target["a_b.c"] == nil {
+		t.Fatalf("a_b.c missing: base %v, target %v", base, target)
+	}
+}
+
+func TestFilterFiles(t *testing.T) {
+	files := []tfdiff.File{
+		{Name: "infra/main.tf"},
+		{Name: "infra/examples/simple/main.tf"},
+		{Name: "infra/modules/vpc/main.tf"},
+		{Name: "examples/main.tf"},
+	}
+	names := func(files []tfdiff.File) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	tests := []struct {
+		patterns []string
+		keep     bool
+		want     []string
+	}{
+		{[]string{"examples"}, false, []string{"infra/main.tf", "infra/examples/simple/main.tf", "infra/modules/vpc/main.tf"}},
+		{rebasePatterns([]string{"examples"}, "infra/"), false, []string{"infra/main.tf", "infra/modules/vpc/main.tf", "examples/main.tf"}},
+		{rebasePatterns([]string{"./examples/"}, "infra/"), false, []string{"infra/main.tf", "infra/modules/vpc/main.tf", "examples/main.tf"}},
+		{[]string{"infra/*"}, true, []string{"infra/main.tf", "infra/examples/simple/main.tf", "infra/modules/vpc/main.tf"}},
+		{[]string{"*/modules/*"}, true, []string{"infra/modules/vpc/main.tf"}},
+	}
+	for _, tt := range tests {
+		if got := names(filterFiles(files, tt.patterns, tt.keep)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filterFiles(%v, %v) = %v, want %v", tt.patterns, tt.keep, got, tt.want)
+		}
+	}
+}
+
+func TestRootFiles(t *testing.T) {
+	call := []byte(`
+module "m" {
+  source = "./modules/m"
+}
+resource "a_b" "c" {}
+`)
+	files := []tfdiff.File{
+		{Name: "infra/main.tf", Content: call},
+		{Name: "infra/modules/m/main.tf", Content: []byte(`resource "a_b" "c" {}`)},
+	}
+	got, roots := rootFiles(files, "infra/")
+	if len(got) != 1 || got[0].Name != "infra/main.tf" || len(roots) > 0 {
+		t.Errorf("rootFiles() = %v, %v, want infra/main.tf only", got, roots)
+	}
+
+	// envs/dev and envs/prod would both define a_b.c
+	files = []tfdiff.File{
+		{Name: "envs/dev/main.tf", Content: []byte(`resource "a_b" "c" {}`)},
+		{Name: "envs/prod/main.tf", Content: []byte(`resource "a_b" "c" {}`)},
+	}
+	if got, roots := rootFiles(files, ""); len(got) > 0 || !reflect.DeepEqual(roots, []string{"envs/dev", "envs/prod"}) {
+		t.Errorf("rootFiles() = %v, %v, want envs/dev and envs/prod skipped", got, roots)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// GitHub rejects comments longer than 65536 characters; the rest is left
+// for what a bot adds around the output.
+const markdownLimit = 60000
+
+// writeMarkdown writes a pull request comment: a table of the differing
+// resources, the terraform plan command, then a collapsed section per
+// modified resource with its changed attributes. Sections that don't fit in
+// a comment are left out, with a note.
+func writeMarkdown(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	changes := resourceChanges(opts, result, baseResources, targetResources)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "### tfdiff: %d to add, %d to change, %d to destroy\n\n", len(result.Added), len(result.Modified), len(result.Removed))
+	if len(changes) > 0 {
+		fmt.Fprintln(&b, "| Resource | Change | File |")
+		fmt.Fprintln(&b, "|---|---|---|")
+		for _, c := range changes {
+			reason := c.Reason
+			if c.MovedFrom != "" {
+				reason += " from `" + c.MovedFrom + "`"
+			}
+			file := changedFile(c, baseResources, targetResources)
+			if c.FileRenamedFrom != "" {
+				file += " (renamed from " + c.FileRenamedFrom + ")"
+			}
+			fmt.Fprintf(&b, "| `%s` | %s | %s |\n", markdownCell(c.Address), reason, markdownCell(file))
+		}
+		fmt.Fprintln(&b)
+	}
+
+	fmt.Fprintf(&b, "```sh\n%s\n```\n", planCommand(opts, result, baseResources, targetResources))
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(&b, "\n> **Warning:** %s\n", warning)
+	}
+
+	omitted := 0
+	for _, c := range changes {
+		if c.Reason != "modified" && c.Reason != "moved" {
+			continue
+		}
+		base, target := baseResources[c.Address], targetResources[c.Address]
+		if base == nil {
+			base = baseResources[c.MovedFrom]
+		}
+		details := markdownDetails(c, base, target)
+		if b.Len()+len(details) > markdownLimit {
+			omitted++
+			continue
+		}
+		b.WriteString(details)
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&b, "\n_The details of %d more resources don't fit in a comment._\n", omitted)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// markdownDetails shows the changed paths of a resource with their values
+// on both sides, or their source text where the values aren't known. Paths
+// into nested blocks are only named.
+func markdownDetails(c resourceChange, base, target *tfdiff.Resource) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n<details><summary><code>%s</code></summary>\n\n", strings.ReplaceAll(c.Address, "<", "&lt;"))
+
+	if len(c.Attributes) == 0 {
+		fmt.Fprintln(&b, "The values differ only once evaluated, so no attribute can be shown.")
+	} else {
+		fmt.Fprintln(&b, "```diff")
+		for _, path := range c.Attributes {
+			from, inBase := attributeValue(base, path)
+			to, inTarget := attributeValue(target, path)
+			if inBase {
+				fmt.Fprintf(&b, "- %s = %s\n", path, from)
+			}
+			if inTarget {
+				fmt.Fprintf(&b, "+ %s = %s\n", path, to)
+			}
+			if !inBase && !inTarget {
+				fmt.Fprintf(&b, "~ %s\n", path)
+			}
+		}
+		fmt.Fprintln(&b, "```")
+	}
+
+	fmt.Fprintln(&b, "\n</details>")
+	return b.String()
+}
+
+// attributeValue renders the value at a dotted attribute path of r.
+func attributeValue(r *tfdiff.Resource, path string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+
+	keys := strings.Split(path, ".")
+	v, ok := r.Attributes[keys[0]]
+	for _, key := range keys[1:] {
+		if !ok || !v.IsKnown() || v.IsNull() {
+			ok = false
+			break
+		}
+		switch t := v.Type(); {
+		case t.IsObjectType():
+			if ok = t.HasAttribute(key); ok {
+				v = v.GetAttr(key)
+			}
+		case t.IsMapType():
+			if ok = v.HasIndex(cty.StringVal(key)).True(); ok {
+				v = v.Index(cty.StringVal(key))
+			}
+		case t.IsListType() || t.IsTupleType():
+			i, err := strconv.Atoi(key)
+			if ok = err == nil && v.HasIndex(cty.NumberIntVal(int64(i))).True(); ok {
+				v = v.Index(cty.NumberIntVal(int64(i)))
+			}
+		default:
+			ok = false
+		}
+	}
+
+	var s string
+	switch {
+	case ok && v.IsWhollyKnown():
+		s = string(hclwrite.TokensForValue(v).Bytes())
+	case len(keys) == 1 && r.Sources[path] != "":
+		s = r.Sources[path]
+	default:
+		return "", false
+	}
+	// multi-line values keep their diff markers on every line
+	return strings.ReplaceAll(s, "\n", "\n  "), true
+}
+
+func changedFile(c resourceChange, baseResources, targetResources map[string]*tfdiff.Resource) string {
+	if r, ok := targetResources[c.Address]; ok && r.File != "" {
+		return r.File
+	}
+	if r, ok := baseResources[c.Address]; ok {
+		return r.File
+	}
+	return ""
+}
+
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", "\\|")
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+const defaultRegistry = "registry.terraform.io"
+
+// A registry source is [HOST/]NAMESPACE/NAME/PROVIDER.
+var registrySource = regexp.MustCompile(`^(?:([a-z0-9.-]+\.[a-z]+)/)?([A-Za-z0-9_-]+)/([A-Za-z0-9_-]+)/([a-z0-9]+)(//.*)?$`)
+
+var exactVersion = regexp.MustCompile(`^=?\s*v?(\d+\.\d+\.\d+(?:-[0-9A-Za-z.-]+)?)$`)
+
+var registryClient = &http.Client{Timeout: 30 * time.Second}
+
+// Both sides usually call the same module versions, so each is only fetched
+// once.
+var fetched = make(map[string][]tfdiff.File)
+
+// fetchModule downloads a registry module. Only exact versions are fetched,
+// since resolving a constraint would need the list of published versions and
+// could pick different versions for the base and the target.
+func fetchModule(source, version string) ([]tfdiff.File, error) {
+	m := registrySource.FindStringSubmatch(source)
+	if m == nil {
+		return nil, nil
+	}
+
+	v := exactVersion.FindStringSubmatch(strings.TrimSpace(version))
+	if v == nil {
+		return nil, fmt.Errorf("version %q is not an exact version", version)
+	}
+
+	key := source + "@" + v[1]
+	if files, ok := fetched[key]; ok {
+		return files, nil
+	}
+
+	host := m[1]
+	if host == "" {
+		host = defaultRegistry
+	}
+
+	base, err := modulesEndpoint(host)
+	if err != nil {
+		return nil, err
+	}
+
+	download, err := base.Parse(fmt.Sprintf("%s/%s/%s/%s/download", m[2], m[3], m[4], v[1]))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := registryClient.Get(download.String())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s returned %s", download, resp.Status)
+	}
+
+	location := resp.Header.Get("X-Terraform-Get")
+	if location == "" {
+		return nil, fmt.Errorf("%s returned no download location", download)
+	}
+
+	fs, dir, err := downloadModule(download, location)
+	if err != nil {
+		return nil, err
+	}
+	if sub := strings.TrimPrefix(m[5], "//"); sub != "" {
+		dir = pathpkg.Join(dir, sub)
+	}
+
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	files, err := readFiles(fs, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Name the files after the module, so they don't resolve to paths in the
+	// repository.
+	for i := range files {
+		files[i].Name = key + "/" + strings.TrimPrefix(files[i].Name, prefix)
+	}
+
+	fetched[key] = files
+	return files, nil
+}
+
+// modulesEndpoint looks up the modules API through terraform's service
+// discovery.
+func modulesEndpoint(host string) (*url.URL, error) {
+	wellKnown := &url.URL{Scheme: "https", Host: host, Path: "/.well-known/terraform.json"}
+
+	resp, err := registryClient.Get(wellKnown.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s returned %s", wellKnown, resp.Status)
+	}
+
+	var services map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&services); err != nil {
+		return nil, fmt.Errorf("%s: %s", wellKnown, err)
+	}
+
+	endpoint, ok := services["modules.v1"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't provide a module registry", host)
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+
+	return wellKnown.Parse(endpoint)
+}
+
+// downloadModule fetches the location returned by the registry, a git
+// repository (git::URL?ref=REF) or an archive, and returns its filesystem and
+// the module directory within it.
+func downloadModule(base *url.URL, location string) (billy.Filesystem, string, error) {
+	location, dir := splitSubdir(location)
+	if dir == "" {
+		dir = "."
+	}
+
+	if strings.HasPrefix(location, "git::") {
+		fs, err := cloneModule(strings.TrimPrefix(location, "git::"))
+		return fs, dir, err
+	}
+
+	u, err := base.Parse(location)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fs, err := downloadArchive(u)
+	return fs, dir, err
+}
+
+// splitSubdir splits the //subdir suffix off a location. Any query string
+// stays with the location.
+func splitSubdir(location string) (string, string) {
+	offset := 0
+	if i := strings.Index(location, "://"); i >= 0 {
+		offset = i + 3
+	}
+
+	i := strings.Index(location[offset:], "//")
+	if i < 0 {
+		return location, ""
+	}
+
+	src, subdir := location[:offset+i], location[offset+i+2:]
+	if q := strings.Index(subdir, "?"); q >= 0 {
+		src += subdir[q:]
+		subdir = subdir[:q]
+	}
+
+	return src, subdir
+}
+
+func cloneModule(location string) (billy.Filesystem, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := u.Query().Get("ref")
+	q := u.Query()
+	q.Del("ref")
+	u.RawQuery = q.Encode()
+
+	var refs []plumbing.ReferenceName
+	if ref != "" {
+		refs = []plumbing.ReferenceName{plumbing.NewTagReferenceName(ref), plumbing.NewBranchReferenceName(ref)}
+	} else {
+		refs = []plumbing.ReferenceName{""}
+	}
+
+	for _, r := range refs {
+		fs := memfs.New()
+		_, err = git.Clone(memory.NewStorage(), fs, &git.CloneOptions{
+			URL:           u.String(),
+			ReferenceName: r,
+			SingleBranch:  true,
+			Depth:         1,
+		})
+		if err == nil {
+			return fs, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to clone %s: %s", u, err)
+}
+
+func downloadArchive(u *url.URL) (billy.Filesystem, error) {
+	resp, err := registryClient.Get(u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s returned %s", u, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := memfs.New()
+	name := u.Path
+	if a := u.Query().Get("archive"); a != "" {
+		name = "." + a
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = extractZip(fs, body)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = extractTarGz(fs, body)
+	default:
+		err = fmt.Errorf("unsupported module archive %s", u)
+	}
+
+	return fs, err
+}
+
+// readArchive extracts an archive file into memory.
+func readArchive(filename string) (billy.Filesystem, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := memfs.New()
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		err = extractZip(fs, body)
+	case strings.HasSuffix(filename, ".tar.gz"), strings.HasSuffix(filename, ".tgz"):
+		err = extractTarGz(fs, body)
+	default:
+		return nil, fmt.Errorf("unsupported archive %s: expected .tar.gz, .tgz or .zip", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	return fs, nil
+}
+
+func extractZip(fs billy.Filesystem, body []byte) error {
+	r, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range r.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		c, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+
+		if err := util.WriteFile(fs, f.Name, c, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func extractTarGz(fs billy.Filesystem, body []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		c, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return err
+		}
+
+		if err := util.WriteFile(fs, h.Name, c, 0644); err != nil {
+			return err
+		}
+	}
+}
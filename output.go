@@ -0,0 +1,504 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// jsonSchemaVersion is bumped whenever jsonOutput changes in a way that can
+// break consumers (a field is removed, renamed or changes type). Adding new
+// fields does not bump it.
+const jsonSchemaVersion = 1
+
+// jsonOutput is the contract of --format json. Every list is always present
+// and is empty rather than null when there is nothing to report.
+type jsonOutput struct {
+	SchemaVersion  int      `json:"schema_version"`
+	Added          []string `json:"added"`
+	Removed        []string `json:"removed"`
+	Modified       []string `json:"modified"`
+	RemovedByBlock []string `json:"removed_by_block"`
+	Targets        []string `json:"targets"`
+	Warnings       []string `json:"warnings"`
+	FullPlan       bool     `json:"full_plan"`
+
+	// Batches is only set with --batches.
+	Batches [][]string `json:"batches,omitempty"`
+
+	// Changes tells why each resource of Added, Modified and Removed
+	// differs, and Command is the terraform plan invocation the plain
+	// format is meant for. Neither is sent to webhooks.
+	Changes []resourceChange `json:"changes,omitempty"`
+	Command string           `json:"command,omitempty"`
+}
+
+func writeOutput(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	if opts.outputTemplate != "" {
+		return writeTemplate(w, opts, result, baseResources, targetResources)
+	}
+
+	switch opts.format {
+	case "", "plain":
+		return writePlain(w, opts, result, baseResources, targetResources)
+	case "args":
+		return writeArgs(w, opts, result, baseResources, targetResources)
+	case "json":
+		return writeJSON(w, opts, result, baseResources, targetResources)
+	case "target-file":
+		return writeTargetFile(w, opts, result)
+	case "tree":
+		return writeTree(w, result)
+	case "csv":
+		return writeCSV(w, opts, result, baseResources, targetResources)
+	case "junit":
+		return writeJUnit(w, opts, result, baseResources, targetResources)
+	case "oneline":
+		return writeOneline(w, result)
+	case "hcl":
+		return writeHCL(w, result, targetResources)
+	case "import":
+		return writeImport(w, result)
+	case "sarif":
+		return writeSARIF(w, opts, result, baseResources, targetResources)
+	case "markdown":
+		return writeMarkdown(w, opts, result, baseResources, targetResources)
+	case "summary":
+		return printSummary(w, result)
+	default:
+		return fmt.Errorf("unknown format: %s", opts.format)
+	}
+}
+
+// targets returns the addresses to emit as -target. Unlike the Added,
+// Removed and Modified lists it honors the options that only affect
+// targeting.
+func targets(opts *options, result tfdiff.DiffResult) []string {
+	var t []string
+	for _, address := range result.Targets() {
+		if isTarget(opts, address) {
+			t = append(t, address)
+		}
+	}
+
+	if opts.relativeModule != "" {
+		t = relativeTargets(opts.relativeModule, t)
+	}
+	return minimalTargets(uniqueSorted(t))
+}
+
+// uniqueSorted sorts addresses and drops repeats, so an address reported
+// twice, such as after relativeTargets, is only targeted once.
+func uniqueSorted(addresses []string) []string {
+	sorted := append([]string{}, addresses...)
+	sort.Strings(sorted)
+
+	var unique []string
+	for i, address := range sorted {
+		if i == 0 || address != sorted[i-1] {
+			unique = append(unique, address)
+		}
+	}
+	return unique
+}
+
+// minimalTargets drops the targets in a module call that is targeted too,
+// since terraform targets everything in a targeted module.
+func minimalTargets(targets []string) []string {
+	var kept []string
+	for _, t := range targets {
+		covered := false
+		for _, other := range targets {
+			if other != t && isModuleCall(other) && refersTo(other, t) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func isTarget(opts *options, address string) bool {
+	if containsString(opts.noTargetTypes, tfdiff.ResourceType(address)) {
+		return false
+	}
+	// with --data-sources=dependents, only the resources reading data
+	// sources bring them into the plan
+	if isDataSource(address) && opts.dataSources == "dependents" {
+		return false
+	}
+	return !isOutput(address)
+}
+
+func isDataSource(address string) bool {
+	return localAddress(address)[0] == "data"
+}
+
+func isOutput(address string) bool {
+	return localAddress(address)[0] == "output"
+}
+
+// localAddress splits an address and drops its module path.
+func localAddress(address string) []string {
+	parts := tfdiff.SplitAddress(address)
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	return parts
+}
+
+// Addresses of for_each instances contain brackets and quotes, so targets
+// are always single-quoted to survive being pasted into a shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+func writePlain(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	differentResources := targets(opts, result)
+	replaced := replacements(opts, result, baseResources, targetResources)
+
+	if opts.fullPlan {
+		fmt.Fprintln(w, "-refresh=true")
+	} else if len(differentResources) > 0 && opts.batches {
+		// one line of targets per terraform apply
+		for _, batch := range batches(differentResources, baseResources, targetResources) {
+			fmt.Fprintln(w, strings.Join(targetArgs(batch, replaced), " "))
+		}
+	} else if len(differentResources) > 0 {
+		fmt.Fprintln(w, strings.Join(targetArgs(differentResources, replaced), " "))
+	} else if opts.emptyOutput != "" {
+		fmt.Fprintln(w, opts.emptyOutput)
+	}
+
+	return nil
+}
+
+// targetArgs returns the terraform arguments targeting targets, quoted for
+// a shell. A resource is targeted for -replace to be in the plan at all.
+func targetArgs(targets []string, replaced map[string]bool) []string {
+	args := terraformArgs(targets, replaced)
+	for i := 1; i < len(args); i += 2 {
+		args[i] = shellQuote(args[i])
+	}
+	return args
+}
+
+// terraformArgs returns the options and addresses targeting targets, in
+// pairs, unquoted.
+func terraformArgs(targets []string, replaced map[string]bool) []string {
+	var args []string
+	for _, address := range targets {
+		args = append(args, "-target", address)
+		if replaced[address] {
+			args = append(args, "-replace", address)
+		}
+	}
+	for _, address := range coveredReplacements(targets, replaced) {
+		args = append(args, "-replace", address)
+	}
+	return args
+}
+
+// writeArgs writes the terraform arguments one per line and unquoted, as
+// -target=ADDRESS, for $(tfdiff --format args), which splits words without
+// removing quotes. Addresses whose keys contain whitespace need
+// xargs -d '\n' instead.
+func writeArgs(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	differentResources := targets(opts, result)
+
+	if opts.fullPlan {
+		fmt.Fprintln(w, "-refresh=true")
+		return nil
+	}
+	if len(differentResources) == 0 {
+		if opts.emptyOutput != "" {
+			fmt.Fprintln(w, opts.emptyOutput)
+		}
+		return nil
+	}
+
+	args := terraformArgs(differentResources, replacements(opts, result, baseResources, targetResources))
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(w, "%s=%s\n", args[i], args[i+1])
+	}
+	return nil
+}
+
+// coveredReplacements returns the replaced resources left out of targets
+// because a module call in targets covers them.
+func coveredReplacements(targets []string, replaced map[string]bool) []string {
+	var covered []string
+	for address, _ := range replaced {
+		if containsString(targets, address) {
+			continue
+		}
+		for _, t := range targets {
+			if refersTo(t, address) {
+				covered = append(covered, address)
+				break
+			}
+		}
+	}
+	sort.Strings(covered)
+	return covered
+}
+
+// replacements returns the modified resources, as targeted, to force the
+// replacement of: those of --replace-types, and those with a change to one
+// of --replace-attributes, given as TYPE.ATTRIBUTE.
+func replacements(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) map[string]bool {
+	replaced := make(map[string]bool)
+	if len(opts.replaceTypes) == 0 && len(opts.replaceAttributes) == 0 {
+		return replaced
+	}
+
+	differ := newDiffer(opts)
+	for _, address := range result.Modified {
+		if isModuleCall(address) || isDataSource(address) || isOutput(address) {
+			continue
+		}
+		t := tfdiff.ResourceType(address)
+
+		replace := containsString(opts.replaceTypes, t)
+		if !replace {
+			var paths []string
+			for _, a := range opts.replaceAttributes {
+				if strings.HasPrefix(a, t+".") {
+					paths = append(paths, strings.TrimPrefix(a, t+"."))
+				}
+			}
+			replace = len(paths) > 0 && changesAttribute(differ.AttributeChanges(baseResources[address], targetResources[address]), paths)
+		}
+		if !replace {
+			continue
+		}
+
+		if isExpanded(targetResources[address]) {
+			warn(fmt.Sprintf("%s has several instances and -replace needs one, so it's only targeted", address))
+			continue
+		}
+
+		if opts.relativeModule != "" {
+			if !strings.HasPrefix(address, opts.relativeModule+".") {
+				continue
+			}
+			address = strings.TrimPrefix(address, opts.relativeModule+".")
+		}
+		replaced[address] = true
+	}
+	return replaced
+}
+
+// isExpanded tells whether r has count or for_each, so its address isn't a
+// single instance.
+func isExpanded(r *tfdiff.Resource) bool {
+	_, count := r.Attributes["count"]
+	_, forEach := r.Attributes["for_each"]
+	return count || forEach
+}
+
+// writeTargetFile writes the format read by terraform's -target-file: one
+// unquoted address per line. Nothing is written when there are no targets,
+// or too many to target.
+func writeTargetFile(w io.Writer, opts *options, result tfdiff.DiffResult) error {
+	if opts.fullPlan {
+		return nil
+	}
+
+	for _, address := range targets(opts, result) {
+		fmt.Fprintln(w, address)
+	}
+	return nil
+}
+
+// writeCSV writes a row per differing resource, followed by a row per changed
+// attribute of modified resources. The attribute column is empty on resource
+// rows.
+func writeCSV(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	differ := newDiffer(opts)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"address", "change_type", "file", "attribute"})
+
+	rows := func(addresses []string, change string, resources map[string]*tfdiff.Resource) {
+		for _, address := range addresses {
+			file := resources[address].File
+			cw.Write([]string{address, change, file, ""})
+
+			if change != "modified" {
+				continue
+			}
+			for _, attr := range differ.AttributeChanges(baseResources[address], targetResources[address]) {
+				cw.Write([]string{address, change, file, attr})
+			}
+		}
+	}
+	rows(result.Added, "added", targetResources)
+	rows(result.Modified, "modified", targetResources)
+	rows(result.Removed, "removed", baseResources)
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeJSON(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(detailedJSONOutput(opts, result, baseResources, targetResources))
+}
+
+// detailedJSONOutput adds what needs the resources to newJSONOutput.
+func detailedJSONOutput(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) jsonOutput {
+	out := newJSONOutput(opts, result)
+	out.Changes = resourceChanges(opts, result, baseResources, targetResources)
+	if opts.batches && !out.FullPlan && len(out.Targets) > 0 {
+		out.Batches = batches(out.Targets, baseResources, targetResources)
+	}
+
+	out.Command = planCommand(opts, result, baseResources, targetResources)
+
+	return out
+}
+
+// planCommand returns the terraform plan invocation the plain output is
+// meant for, quoted the same way, on one line.
+func planCommand(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) string {
+	plain := *opts
+	plain.batches = false
+	var args bytes.Buffer
+	writePlain(&args, &plain, result, baseResources, targetResources)
+	return strings.TrimSpace("terraform plan " + args.String())
+}
+
+func newJSONOutput(opts *options, result tfdiff.DiffResult) jsonOutput {
+	t := targets(opts, result)
+	return jsonOutput{
+		SchemaVersion:  jsonSchemaVersion,
+		Added:          nonNil(result.Added),
+		Removed:        nonNil(result.Removed),
+		Modified:       nonNil(result.Modified),
+		RemovedByBlock: nonNil(result.RemovedByBlock),
+		Targets:        nonNil(t),
+		Warnings:       nonNil(result.Warnings),
+		FullPlan:       opts.fullPlan,
+	}
+}
+
+func printSummary(w io.Writer, result tfdiff.DiffResult) error {
+	for _, name := range result.Added {
+		fmt.Fprintf(w, "+ %s\n", name)
+	}
+	for _, name := range result.Modified {
+		fmt.Fprintf(w, "~ %s\n", name)
+	}
+	for _, name := range result.Removed {
+		fmt.Fprintf(w, "- %s\n", name)
+	}
+	for _, name := range result.RemovedByBlock {
+		fmt.Fprintf(w, "- %s (removed block)\n", name)
+	}
+
+	// tfdiff can't tell an in-place update from a replacement, so this is
+	// only a rough approximation of terraform plan's summary line.
+	fmt.Fprintf(w, "Static estimate: %d to add, %d to change, %d to destroy.\n",
+		countResources(result.Added), countResources(result.Modified), countResources(result.Removed))
+
+	return nil
+}
+
+// writeOneline prints the counts only, for shell prompts and status lines.
+func writeOneline(w io.Writer, result tfdiff.DiffResult) error {
+	_, err := fmt.Fprintf(w, "tfdiff: +%d ~%d -%d\n",
+		countResources(result.Added), countResources(result.Modified), countResources(result.Removed))
+	return err
+}
+
+// writeHCL prints the target version of every added and modified resource,
+// formatted, under a comment naming its address and file.
+func writeHCL(w io.Writer, result tfdiff.DiffResult, targetResources map[string]*tfdiff.Resource) error {
+	addresses := append(append([]string(nil), result.Added...), result.Modified...)
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		r := targetResources[address]
+		fmt.Fprintf(w, "# %s (%s)\n", address, r.File)
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(string(hclwrite.Format(r.Source))))
+	}
+	return nil
+}
+
+// writeImport prints a terraform import command for every added resource,
+// for resources that already exist outside the state. Module calls, data
+// sources and outputs can't be imported.
+func writeImport(w io.Writer, result tfdiff.DiffResult) error {
+	for _, address := range result.Added {
+		if isModuleCall(address) || isDataSource(address) || isOutput(address) {
+			continue
+		}
+		fmt.Fprintf(w, "terraform import %s <id>\n", shellQuote(address))
+	}
+	return nil
+}
+
+// Only managed resources are part of terraform plan's counts, not outputs,
+// data sources, module calls or settings.
+func countResources(addresses []string) int {
+	n := 0
+	for _, address := range addresses {
+		kind := localAddress(address)[0]
+		if kind == "output" || kind == "data" || isModuleCall(address) || tfdiff.IsSetting(address) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func reportOnly(w io.Writer, differ *tfdiff.Differ, address string, base, target *tfdiff.Resource) error {
+	switch {
+	case base == nil && target == nil:
+		return fmt.Errorf("%s not found", address)
+	case base == nil:
+		fmt.Fprintf(w, "+ %s\n", address)
+	case target == nil:
+		fmt.Fprintf(w, "- %s\n", address)
+	default:
+		changes := differ.AttributeChanges(base, target)
+		if len(changes) == 0 {
+			fmt.Fprintf(w, "  %s (unchanged)\n", address)
+			return nil
+		}
+
+		fmt.Fprintf(w, "~ %s\n", address)
+		for _, c := range changes {
+			fmt.Fprintf(w, "    ~ %s\n", c)
+		}
+	}
+
+	return errChanged
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+func TestCountResources(t *testing.T) {
+	addresses := []string{
+		"aws_instance.a",
+		"module.vpc.aws_subnet.b",
+		"data.aws_ami.c",
+		"module.vpc.data.aws_ami.d",
+		"module.vpc",
+		`module.net["a"]`,
+		"output.id",
+		"terraform.backend",
+		"terraform.required_providers",
+	}
+	if n := countResources(addresses); n != 2 {
+		t.Errorf("countResources() = %d, want 2", n)
+	}
+}
+
+var quotedAddresses = []string{
+	"aws_instance.a",
+	`aws_s3_bucket.this["my-bucket.example.com"]`,
+	`aws_s3_bucket.this["it's"]`,
+	`module.net["a b"].aws_subnet.this[0]`,
+	`aws_iam_user.u["$HOME"]`,
+}
+
+func TestShellQuote(t *testing.T) {
+	for _, address := range quotedAddresses {
+		// the shell must hand the address back unchanged
+		out, err := exec.Command("sh", "-c", "printf %s "+shellQuote(address)).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != address {
+			t.Errorf("shellQuote(%s) reads back as %s", address, out)
+		}
+	}
+}
+
+func TestWritePlainQuotesTargets(t *testing.T) {
+	var b bytes.Buffer
+	result := tfdiff.DiffResult{Modified: quotedAddresses}
+	if err := writePlain(&b, &options{}, result, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("sh", "-c", "printf '%s\\n' "+b.String()).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, arg := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if arg != "-target" {
+			got = append(got, arg)
+		}
+	}
+	want := uniqueSorted(quotedAddresses)
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("targets read back as %q, want %q", got, want)
+	}
+}
+
+// shellArgs returns the arguments sh makes of script run with out on
+// standard input.
+func shellArgs(t *testing.T, script, out string) []string {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script+`; for a in "$@"; do printf '%s\n' "$a"; done`)
+	cmd.Stdin = strings.NewReader(out)
+	b, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestWriteArgs(t *testing.T) {
+	addresses := []string{
+		"aws_instance.a",
+		`aws_s3_bucket.this["my-bucket.example.com"]`,
+		`aws_s3_bucket.this["it's"]`,
+		`module.net["a"].aws_subnet.this[0]`,
+	}
+	result := tfdiff.DiffResult{Modified: addresses}
+
+	var want []string
+	for _, address := range uniqueSorted(addresses) {
+		want = append(want, "-target="+address)
+	}
+
+	var b bytes.Buffer
+	if err := writeArgs(&b, &options{}, result, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// terraform plan $(tfdiff --format args)
+	if got := shellArgs(t, `set -- $(cat)`, b.String()); !reflect.DeepEqual(got, want) {
+		t.Errorf("$(tfdiff --format args) = %q, want %q", got, want)
+	}
+
+	// eval "terraform plan $(tfdiff)" with the default format
+	b.Reset()
+	if err := writePlain(&b, &options{}, result, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var pairs []string
+	for _, arg := range want {
+		pairs = append(pairs, "-target", strings.TrimPrefix(arg, "-target="))
+	}
+	if got := shellArgs(t, `eval "set -- $(cat)"`, b.String()); !reflect.DeepEqual(got, pairs) {
+		t.Errorf("eval $(tfdiff) = %q, want %q", got, pairs)
+	}
+}
+
+func TestLocalAddress(t *testing.T) {
+	tests := []struct {
+		address    string
+		want       []string
+		dataSource bool
+	}{
+		{"aws_instance.a", []string{"aws_instance", "a"}, false},
+		{`module.net["a.b"].aws_subnet.x`, []string{"aws_subnet", "x"}, false},
+		{`module.net["data.x"].data.aws_ami.x`, []string{"data", "aws_ami", "x"}, true},
+		{`aws_s3_bucket.this["my-bucket.example.com"]`, []string{"aws_s3_bucket", `this["my-bucket.example.com"]`}, false},
+		{`module.a["x\".y"].module.b.data.aws_ami.x`, []string{"data", "aws_ami", "x"}, true},
+	}
+	for _, tt := range tests {
+		if got := localAddress(tt.address); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("localAddress(%s) = %q, want %q", tt.address, got, tt.want)
+		}
+		if got := isDataSource(tt.address); got != tt.dataSource {
+			t.Errorf("isDataSource(%s) = %t, want %t", tt.address, got, tt.dataSource)
+		}
+	}
+}
+
+func TestIsTargetNoTargetTypes(t *testing.T) {
+	opts := &options{noTargetTypes: []string{"null_resource"}}
+	for address, want := range map[string]bool{
+		`module.net["null_resource.x"].aws_subnet.a`: true,
+		`module.net["a.b"].null_resource.a`:          false,
+		`null_resource.this["example.com"]`:          false,
+	} {
+		if got := isTarget(opts, address); got != want {
+			t.Errorf("isTarget(%s) = %t, want %t", address, got, want)
+		}
+	}
+}
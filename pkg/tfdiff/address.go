@@ -0,0 +1,30 @@
+package tfdiff
+
+// SplitAddress splits a resource address at its dots. Dots within instance
+// keys, such as module.net["a.b"] or aws_s3_bucket.this["example.com"],
+// don't split it, so a key stays attached to the name it indexes.
+func SplitAddress(address string) []string {
+	var parts []string
+	start, depth := 0, 0
+	quoted, escaped := false, false
+	for i := 0; i < len(address); i++ {
+		c := address[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case c == '.' && depth == 0:
+			parts = append(parts, address[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, address[start:])
+}
@@ -0,0 +1,61 @@
+package tfdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    []string
+	}{
+		{"aws_instance.a", []string{"aws_instance", "a"}},
+		{"data.aws_ami.a", []string{"data", "aws_ami", "a"}},
+		{"module.vpc.aws_subnet.a[0]", []string{"module", "vpc", "aws_subnet", "a[0]"}},
+		{`aws_s3_bucket.this["my-bucket.example.com"]`, []string{"aws_s3_bucket", `this["my-bucket.example.com"]`}},
+		{`module.net["a.b"].aws_subnet.x`, []string{"module", `net["a.b"]`, "aws_subnet", "x"}},
+		{`module.net["a]b.c"].data.aws_ami.x`, []string{"module", `net["a]b.c"]`, "data", "aws_ami", "x"}},
+		{`aws_iam_user.u["say \"hi.there\""]`, []string{"aws_iam_user", `u["say \"hi.there\""]`}},
+		{`aws_iam_user.u["back\\"].x`, []string{"aws_iam_user", `u["back\\"]`, "x"}},
+		{"module.vpc", []string{"module", "vpc"}},
+	}
+	for _, tt := range tests {
+		if got := SplitAddress(tt.address); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitAddress(%s) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestResourceType(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		{"aws_instance.a", "aws_instance"},
+		{"data.aws_ami.a", "aws_ami"},
+		{`aws_s3_bucket.this["my-bucket.example.com"]`, "aws_s3_bucket"},
+		{`module.net["a.b"].aws_subnet.x`, "aws_subnet"},
+		{`module.net["data.aws_ami"].data.aws_ami.x`, "aws_ami"},
+		{`module.net["x\"].y"].null_resource.z`, "null_resource"},
+	}
+	for _, tt := range tests {
+		if got := ResourceType(tt.address); got != tt.want {
+			t.Errorf("ResourceType(%s) = %s, want %s", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestIsModuleCall(t *testing.T) {
+	for address, want := range map[string]bool{
+		"module.vpc":                     true,
+		`module.net["a.b"]`:              true,
+		`module.net["a.b"].module.vpc`:   true,
+		`module.net["a.b"].aws_subnet.x`: false,
+		`aws_s3_bucket.this["module.x"]`: false,
+	} {
+		if got := isModuleCall(address); got != want {
+			t.Errorf("isModuleCall(%s) = %t, want %t", address, got, want)
+		}
+	}
+}
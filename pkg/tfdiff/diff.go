@@ -0,0 +1,784 @@
+package tfdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// DiffResult classifies the resources that differ between two configurations.
+// Every list is sorted, so output built from it is reproducible.
+type DiffResult struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+	Warnings []string
+
+	// BackendChanged is set when the backend configuration differs. The
+	// state then lives elsewhere, so targeting the differing resources
+	// isn't meaningful.
+	BackendChanged bool
+
+	// ProvidersChanged is set when the provider requirements differ, which
+	// can change the plan of every resource of the affected providers.
+	ProvidersChanged bool
+
+	// RemovedByBlock lists the removed resources a removed block of the
+	// target declares the removal of. They're intended, so they aren't in
+	// Removed and aren't targets.
+	RemovedByBlock []string
+}
+
+// Differ compares resources. The zero value compares attribute values
+// exactly.
+type Differ struct {
+	// IgnoreOrder compares list and tuple values as multisets, so
+	// reordering their elements isn't a change. This also hides changes
+	// where the order is significant, such as ordered_cache_behavior.
+	IgnoreOrder bool
+
+	// Defaults holds provider default values by resource type and
+	// attribute name. A top-level attribute set on one side only, to its
+	// default value, isn't a change.
+	Defaults map[string]map[string]cty.Value
+
+	// AssumeChangedOnUnknown reports a resource as modified whenever either
+	// side has a value that can't be evaluated statically, since what such a
+	// value refers to may change while its source text doesn't.
+	AssumeChangedOnUnknown bool
+
+	// IgnoreAttributes holds path.Match patterns, such as *_arn, of
+	// attribute names left out of the comparison at any nesting level.
+	// It is meant for computed values hardcoded in configuration.
+	IgnoreAttributes []string
+
+	// IgnoreMoves hides pure relocations without a moved block: resources
+	// renamed with identical content (with a warning, since terraform
+	// replaces them) and module calls whose local source directory moved.
+	// Resources moved by moved blocks are always compared with what they
+	// were moved from.
+	IgnoreMoves bool
+
+	// IgnoreProviderVersions only warns about provider requirement changes
+	// confined to version constraints, instead of setting
+	// DiffResult.ProvidersChanged. Source changes are still reported.
+	IgnoreProviderVersions bool
+
+	// IgnoreWhitespace compares strings holding JSON, such as inline policy
+	// documents, by their canonical form, and other strings with runs of
+	// whitespace collapsed.
+	IgnoreWhitespace bool
+
+	// CanonicalizeJSON compares strings that both hold JSON, such as
+	// jsonencode results and IAM policies, with their object keys sorted
+	// and insignificant whitespace removed. Other strings compare exactly.
+	CanonicalizeJSON bool
+
+	// MissingAsDefault treats an object key missing on one side as equal
+	// to a null or empty value on the other, which is what optional object
+	// attributes without a default come out as.
+	MissingAsDefault bool
+
+	// Normalizers are applied to both sides of every comparison, in order.
+	Normalizers []Normalizer
+
+	// Key, when set, returns the identity resources are correlated by
+	// instead of their address, such as a tag. Resources it returns ""
+	// for keep their address. Modified and added resources are reported
+	// at their target address, removed ones at their base address.
+	Key func(address string, r *Resource) string
+}
+
+// DiffContent parses two configurations and diffs their resources.
+func DiffContent(base, target []byte) (DiffResult, error) {
+	baseResources, err := ParseResources([]File{{Name: "base.tf", Content: base}})
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	targetResources, err := ParseResources([]File{{Name: "target.tf", Content: target}})
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	return Diff(baseResources, targetResources), nil
+}
+
+// Diff compares the resources of a base and a target configuration.
+func Diff(baseResources, targetResources map[string]*Resource) DiffResult {
+	d := &Differ{}
+	return d.Diff(baseResources, targetResources)
+}
+
+// Diff compares the resources of a base and a target configuration.
+func (d *Differ) Diff(baseResources, targetResources map[string]*Resource) DiffResult {
+	result := DiffResult{}
+
+	var baseAddresses, targetAddresses map[string]string
+	if d.Key != nil {
+		baseResources, baseAddresses = d.rekey(&result, baseResources)
+		targetResources, targetAddresses = d.rekey(&result, targetResources)
+	}
+
+	for name, _ := range baseResources {
+		if baseResources[name].Ignored {
+			continue
+		}
+		if _, ok := targetResources[name]; !ok {
+			result.Removed = append(result.Removed, name)
+
+			if preventDestroy(baseResources[name]).True() {
+				result.Warnings = append(result.Warnings, fmt.Sprintf("%s is removed but has lifecycle.prevent_destroy set", name))
+			}
+			continue
+		}
+
+		if targetResources[name].Ignored {
+			continue
+		}
+
+		if !d.equalResources(baseResources[name], targetResources[name]) || d.AssumeChangedOnUnknown && (HasUnknown(baseResources[name]) || HasUnknown(targetResources[name])) {
+			result.Modified = append(result.Modified, name)
+
+			if w := preventDestroyWarning(baseResources[name], targetResources[name]); w != "" {
+				result.Warnings = append(result.Warnings, w)
+			}
+			if w := expansionWarning(baseResources[name], targetResources[name]); w != "" {
+				result.Warnings = append(result.Warnings, w)
+			}
+		}
+	}
+
+	for name, _ := range targetResources {
+		if _, ok := baseResources[name]; !ok && !targetResources[name].Ignored {
+			result.Added = append(result.Added, name)
+		}
+	}
+
+	d.pairMoves(&result, baseResources, targetResources)
+	if d.IgnoreMoves {
+		d.collapseMoves(&result, baseResources, targetResources)
+	}
+	d.warnScopeMoves(&result, baseResources, targetResources)
+
+	var removals bool
+	result.Added = removeAddress(result.Added, RemovalsAddress, &removals)
+	result.Removed = removeAddress(result.Removed, RemovalsAddress, &removals)
+	result.Modified = removeAddress(result.Modified, RemovalsAddress, &removals)
+	reconcileRemovals(&result, targetResources[RemovalsAddress])
+
+	var backend, providers bool
+	result.Added = removeAddress(result.Added, BackendAddress, &backend)
+	result.Removed = removeAddress(result.Removed, BackendAddress, &backend)
+	result.Modified = removeAddress(result.Modified, BackendAddress, &backend)
+	if backend {
+		result.BackendChanged = true
+		result.Warnings = append(result.Warnings, "the backend configuration changes; the state moves, so a full plan is needed")
+	}
+
+	result.Added = removeAddress(result.Added, RequiredProvidersAddress, &providers)
+	result.Removed = removeAddress(result.Removed, RequiredProvidersAddress, &providers)
+	result.Modified = removeAddress(result.Modified, RequiredProvidersAddress, &providers)
+	if providers {
+		base, target := baseResources[RequiredProvidersAddress], targetResources[RequiredProvidersAddress]
+		if d.IgnoreProviderVersions && d.equalBlocks(withoutVersions(base), withoutVersions(target)) {
+			result.Warnings = append(result.Warnings, "provider version constraints change")
+		} else {
+			result.ProvidersChanged = true
+			result.Warnings = append(result.Warnings, "the provider requirements change, which can affect every resource of those providers; a full plan is needed")
+		}
+	}
+
+	if d.Key != nil {
+		result.Added = addresses(result.Added, targetAddresses)
+		result.Removed = addresses(result.Removed, baseAddresses)
+		result.RemovedByBlock = addresses(result.RemovedByBlock, baseAddresses)
+		result.Modified = addresses(result.Modified, targetAddresses)
+	}
+
+	result.Sort()
+	return result
+}
+
+// rekey returns resources by their Key, and the address of every key.
+// Settings keep their address, and of resources sharing a key the first
+// address in sorted order wins.
+func (d *Differ) rekey(result *DiffResult, resources map[string]*Resource) (map[string]*Resource, map[string]string) {
+	var names []string
+	for name, _ := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	keyed := make(map[string]*Resource)
+	addresses := make(map[string]string)
+	for _, name := range names {
+		key := ""
+		if !IsSetting(name) {
+			key = d.Key(name, resources[name])
+		}
+		if key == "" {
+			key = name
+		}
+		if other, ok := addresses[key]; ok {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("%s has the same key as %s and is ignored", name, other))
+			continue
+		}
+		keyed[key] = resources[name]
+		addresses[key] = name
+	}
+	return keyed, addresses
+}
+
+func addresses(keys []string, addresses map[string]string) []string {
+	var a []string
+	for _, key := range keys {
+		a = append(a, addresses[key])
+	}
+	return a
+}
+
+// removeAddress drops setting from addresses, noting whether it was there.
+func removeAddress(addresses []string, setting string, found *bool) []string {
+	var kept []string
+	for _, address := range addresses {
+		if address == setting {
+			*found = true
+			continue
+		}
+		kept = append(kept, address)
+	}
+	return kept
+}
+
+// withoutVersions returns the provider requirements of r with their version
+// constraints left out. The legacy form, a bare version string, is left
+// with nothing.
+func withoutVersions(r *Resource) Block {
+	b := Block{Attributes: make(map[string]cty.Value)}
+	if r == nil {
+		return b
+	}
+
+	for name, v := range r.Attributes {
+		if !v.IsWhollyKnown() || v.IsNull() || !isMapping(v.Type()) {
+			b.Attributes[name] = cty.EmptyObjectVal
+			continue
+		}
+		attrs := make(map[string]cty.Value)
+		for k, av := range v.AsValueMap() {
+			if k != "version" {
+				attrs[k] = av
+			}
+		}
+		b.Attributes[name] = cty.ObjectVal(attrs)
+	}
+	return b
+}
+
+// Sort sorts every list of the result.
+func (r DiffResult) Sort() {
+	sort.Strings(r.Added)
+	sort.Strings(r.Removed)
+	sort.Strings(r.RemovedByBlock)
+	sort.Strings(r.Modified)
+	sort.Strings(r.Warnings)
+}
+
+// Targets returns every differing resource address.
+func (r DiffResult) Targets() []string {
+	var targets []string
+	targets = append(targets, r.Removed...)
+	targets = append(targets, r.Modified...)
+	targets = append(targets, r.Added...)
+	return targets
+}
+
+// AttributeChanges returns the dotted paths of the attributes and blocks that
+// differ between two versions of a resource. Either side may be nil.
+func AttributeChanges(base, target *Resource) []string {
+	d := &Differ{}
+	return d.AttributeChanges(base, target)
+}
+
+// AttributeChanges returns the dotted paths of the attributes and blocks that
+// differ between two versions of a resource. Either side may be nil. Object
+// and map values are descended into, as are lists and tuples of the same
+// length, so a change is reported where it happens, such as settings.b.c or
+// ingress[0].port.
+func (d *Differ) AttributeChanges(base, target *Resource) []string {
+	base, target = d.normalize(base), d.normalize(target)
+
+	var b, t Block
+	if base != nil {
+		b = Block{Attributes: base.Attributes, Blocks: base.Blocks, Sources: base.Sources}
+	}
+	if target != nil {
+		t = Block{Attributes: target.Attributes, Blocks: target.Blocks, Sources: target.Sources}
+	}
+	if base != nil && target != nil {
+		defaults := d.Defaults[ResourceType(target.Name)]
+		b.Attributes = withDefaults(base.Attributes, target.Attributes, defaults)
+		t.Attributes = withDefaults(target.Attributes, base.Attributes, defaults)
+	}
+
+	changes := d.blockChanges("", b, t)
+	if base != nil && target != nil && base.Provider != target.Provider {
+		if strings.HasPrefix(target.Name, "module.") {
+			changes = append(changes, "providers")
+		} else {
+			changes = append(changes, "provider")
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func (d *Differ) blockChanges(prefix string, base, target Block) []string {
+	var changes []string
+
+	baseAttributes, targetAttributes := d.compared(base.Attributes), d.compared(target.Attributes)
+	for name, bv := range baseAttributes {
+		tv, ok := targetAttributes[name]
+		if !ok {
+			changes = append(changes, prefix+name)
+		} else if !d.equalAttributes(bv, tv, base.Sources[name], target.Sources[name]) {
+			changes = append(changes, d.valueChanges(prefix+name, bv, tv)...)
+		}
+	}
+	for name, _ := range targetAttributes {
+		if _, ok := baseAttributes[name]; !ok {
+			changes = append(changes, prefix+name)
+		}
+	}
+
+	for typ, bb := range base.Blocks {
+		tb, ok := target.Blocks[typ]
+		if !ok || len(bb) != len(tb) {
+			changes = append(changes, prefix+typ)
+			continue
+		}
+		for i, b := range bb {
+			// repeated blocks are told apart by their position
+			p := prefix + typ + "."
+			if len(bb) > 1 {
+				p = fmt.Sprintf("%s%s[%d].", prefix, typ, i)
+			}
+			changes = append(changes, d.blockChanges(p, b, tb[i])...)
+		}
+	}
+	for typ, _ := range target.Blocks {
+		if _, ok := base.Blocks[typ]; !ok {
+			changes = append(changes, prefix+typ)
+		}
+	}
+
+	return changes
+}
+
+// valueChanges returns the paths below path where a and b differ. Values
+// that can't be descended into are reported at path itself.
+func (d *Differ) valueChanges(path string, a, b cty.Value) []string {
+	if !a.IsKnown() || !b.IsKnown() || a.IsNull() || b.IsNull() {
+		return []string{path}
+	}
+
+	var changes []string
+	at, bt := a.Type(), b.Type()
+	switch {
+	case isMapping(at) && isMapping(bt):
+		am, bm := a.AsValueMap(), b.AsValueMap()
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok {
+				if !d.MissingAsDefault || !isEmpty(av) {
+					changes = append(changes, keyPath(path, k))
+				}
+			} else if !d.equalValues(av, bv) {
+				changes = append(changes, d.valueChanges(keyPath(path, k), av, bv)...)
+			}
+		}
+		for k, bv := range bm {
+			if _, ok := am[k]; !ok && (!d.MissingAsDefault || !isEmpty(bv)) {
+				changes = append(changes, keyPath(path, k))
+			}
+		}
+	case isSequence(at) && isSequence(bt) && !d.IgnoreOrder && a.LengthInt() == b.LengthInt():
+		bs := b.AsValueSlice()
+		for i, av := range a.AsValueSlice() {
+			if !d.equalValues(av, bs[i]) {
+				changes = append(changes, d.valueChanges(fmt.Sprintf("%s[%d]", path, i), av, bs[i])...)
+			}
+		}
+	}
+
+	if len(changes) == 0 {
+		return []string{path}
+	}
+	return changes
+}
+
+// Keys that aren't identifiers, such as tag names with spaces, are quoted.
+func keyPath(path, key string) string {
+	if hclsyntax.ValidIdentifier(key) {
+		return path + "." + key
+	}
+	return fmt.Sprintf("%s[%q]", path, key)
+}
+
+func isMapping(t cty.Type) bool {
+	return t.IsObjectType() || t.IsMapType()
+}
+
+func (d *Differ) equalResources(a, b *Resource) bool {
+	a, b = d.normalize(a), d.normalize(b)
+	defaults := d.Defaults[ResourceType(a.Name)]
+	return a.Provider == b.Provider &&
+		d.equalBlocks(
+			Block{Attributes: withDefaults(a.Attributes, b.Attributes, defaults), Blocks: a.Blocks, Sources: a.Sources},
+			Block{Attributes: withDefaults(b.Attributes, a.Attributes, defaults), Blocks: b.Blocks, Sources: b.Sources})
+}
+
+// withDefaults returns attrs with the default value of every attribute that
+// is only set in other, so setting an attribute to its default compares
+// equal to leaving it out.
+func withDefaults(attrs, other map[string]cty.Value, defaults map[string]cty.Value) map[string]cty.Value {
+	if len(defaults) == 0 {
+		return attrs
+	}
+
+	filled := make(map[string]cty.Value)
+	for name, v := range attrs {
+		filled[name] = v
+	}
+	for name, def := range defaults {
+		v, ok := other[name]
+		if _, set := attrs[name]; set || !ok {
+			continue
+		}
+		if c, err := convert.Convert(def, v.Type()); err == nil {
+			def = c
+		}
+		filled[name] = def
+	}
+
+	return filled
+}
+
+// ResourceType returns the type of the resource or data source at address,
+// ignoring its module path.
+func ResourceType(address string) string {
+	parts := SplitAddress(address)
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	if parts[0] == "data" && len(parts) > 1 {
+		return parts[1]
+	}
+	return parts[0]
+}
+
+func (d *Differ) equalBlocks(a, b Block) bool {
+	aAttributes, bAttributes := d.compared(a.Attributes), d.compared(b.Attributes)
+	if len(aAttributes) != len(bAttributes) || len(a.Blocks) != len(b.Blocks) {
+		return false
+	}
+
+	for name, av := range aAttributes {
+		bv, ok := bAttributes[name]
+		if !ok || !d.equalAttributes(av, bv, a.Sources[name], b.Sources[name]) {
+			return false
+		}
+	}
+
+	for typ, ab := range a.Blocks {
+		bb, ok := b.Blocks[typ]
+		if !ok || len(ab) != len(bb) {
+			return false
+		}
+		for i, nested := range ab {
+			if !d.equalBlocks(nested, bb[i]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// compared returns the attributes not matching IgnoreAttributes.
+func (d *Differ) compared(attrs map[string]cty.Value) map[string]cty.Value {
+	if len(d.IgnoreAttributes) == 0 {
+		return attrs
+	}
+
+	kept := make(map[string]cty.Value)
+	for name, v := range attrs {
+		ignored := false
+		for _, p := range d.IgnoreAttributes {
+			if ok, _ := path.Match(p, name); ok {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			kept[name] = v
+		}
+	}
+	return kept
+}
+
+// Unknown values would always compare equal, so when either side can't be
+// evaluated statically the attributes are compared by their source text.
+func (d *Differ) equalAttributes(a, b cty.Value, aSource, bSource string) bool {
+	if (!a.IsWhollyKnown() || !b.IsWhollyKnown()) && aSource != "" && bSource != "" {
+		return aSource == bSource
+	}
+	return d.equalValues(a, b)
+}
+
+// Values are compared by content rather than by type: the same elements
+// in a tuple literal, a list or a set, or the same keys in an object or a
+// map, are equal, since terraform converts both to the attribute's type.
+// Sets are unordered, so compared with any sequence they are compared as
+// multisets.
+func (d *Differ) equalValues(a, b cty.Value) bool {
+	if a.IsNull() && b.IsNull() {
+		return true
+	}
+	// collections with unknown elements are still compared element by
+	// element; an unknown value only equals an unknown of the same type
+	a, b = unmark(a), unmark(b)
+	if !a.IsKnown() || !b.IsKnown() || a.IsNull() || b.IsNull() {
+		return a.RawEquals(b)
+	}
+
+	at, bt := a.Type(), b.Type()
+	switch {
+	case d.IgnoreWhitespace && at == cty.String && bt == cty.String:
+		return canonicalString(a.AsString()) == canonicalString(b.AsString())
+	case d.CanonicalizeJSON && at == cty.String && bt == cty.String:
+		aj, aok := canonicalJSON(a.AsString())
+		bj, bok := canonicalJSON(b.AsString())
+		if aok && bok {
+			return aj == bj
+		}
+		return a.Equals(b).True()
+	case isCollection(at) && isCollection(bt) && (d.IgnoreOrder || at.IsSetType() || bt.IsSetType()):
+		return d.equalMultisets(a.AsValueSlice(), b.AsValueSlice())
+	case isSequence(at) && isSequence(bt):
+		as, bs := a.AsValueSlice(), b.AsValueSlice()
+		if len(as) != len(bs) {
+			return false
+		}
+		for i, av := range as {
+			if !d.equalValues(av, bs[i]) {
+				return false
+			}
+		}
+		return true
+	case (at.IsObjectType() || at.IsMapType()) && (bt.IsObjectType() || bt.IsMapType()):
+		am, bm := a.AsValueMap(), b.AsValueMap()
+		if len(am) != len(bm) && !d.MissingAsDefault {
+			return false
+		}
+		for k, av := range am {
+			bv, ok := bm[k]
+			if !ok && d.MissingAsDefault && isEmpty(av) {
+				continue
+			}
+			if !ok || !d.equalValues(av, bv) {
+				return false
+			}
+		}
+		for k, bv := range bm {
+			if _, ok := am[k]; !ok && !isEmpty(bv) {
+				return false
+			}
+		}
+		return true
+	case at.IsPrimitiveType() && at == bt:
+		// numbers of the same value can differ in precision
+		return a.Equals(b).True()
+	default:
+		return a.RawEquals(b)
+	}
+}
+
+func (d *Differ) equalMultisets(a, b []cty.Value) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	used := make([]bool, len(b))
+	for _, av := range a {
+		found := false
+		for i, bv := range b {
+			if !used[i] && d.equalValues(av, bv) {
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HasUnknown tells whether r has values that can't be evaluated statically,
+// such as references to other resources.
+func HasUnknown(r *Resource) bool {
+	return blockHasUnknown(Block{Attributes: r.Attributes, Blocks: r.Blocks})
+}
+
+func blockHasUnknown(b Block) bool {
+	for _, v := range b.Attributes {
+		if !v.IsWhollyKnown() {
+			return true
+		}
+	}
+	for _, blocks := range b.Blocks {
+		for _, nested := range blocks {
+			if blockHasUnknown(nested) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEmpty tells whether v is null or the zero value of its type.
+func isEmpty(v cty.Value) bool {
+	if v.IsNull() {
+		return true
+	}
+	if !v.IsWhollyKnown() {
+		return false
+	}
+
+	t := v.Type()
+	switch {
+	case t == cty.String:
+		return v.AsString() == ""
+	case t == cty.Bool:
+		return v.False()
+	case t == cty.Number:
+		return v.Equals(cty.Zero).True()
+	case t.IsListType() || t.IsSetType() || t.IsTupleType() || t.IsMapType() || t.IsObjectType():
+		return v.LengthInt() == 0
+	}
+	return false
+}
+
+func canonicalString(s string) string {
+	if j, ok := canonicalJSON(s); ok {
+		return j
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// canonicalJSON re-encodes s when it holds a JSON object or array.
+func canonicalJSON(s string) (string, bool) {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return "", false
+	}
+
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil || dec.More() {
+		return "", false
+	}
+	// maps are marshaled with their keys sorted
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+func isSequence(t cty.Type) bool {
+	return t.IsListType() || t.IsTupleType()
+}
+
+func isCollection(t cty.Type) bool {
+	return isSequence(t) || t.IsSetType()
+}
+
+// A targeted apply is only safe if prevent_destroy still means what the
+// reviewer expects, so changes to it are reported as warnings.
+func preventDestroyWarning(base, target *Resource) string {
+	b, t := preventDestroy(base), preventDestroy(target)
+	if b.RawEquals(t) {
+		return ""
+	}
+
+	return fmt.Sprintf("%s changes lifecycle.prevent_destroy from %s to %s", target.Name, formatBool(b), formatBool(t))
+}
+
+// Going from a single instance to count (or back) changes instance addresses
+// from NAME to NAME[0]. The resource-level target covers both forms, but the
+// transition is easy to miss in review, so it is reported explicitly.
+func expansionWarning(base, target *Resource) string {
+	b, t := expansion(base), expansion(target)
+	if b == t {
+		return ""
+	}
+
+	switch {
+	case b == "":
+		if t == "count" {
+			return fmt.Sprintf("%s gains count; terraform moves %s to %s[0]", target.Name, target.Name, target.Name)
+		}
+		return fmt.Sprintf("%s gains %s; the existing instance will be replaced by keyed instances", target.Name, t)
+	case t == "":
+		if b == "count" {
+			return fmt.Sprintf("%s loses count; terraform moves %s[0] to %s and destroys the other instances", target.Name, target.Name, target.Name)
+		}
+		return fmt.Sprintf("%s loses %s; the keyed instances will be replaced by a single instance", target.Name, b)
+	default:
+		return fmt.Sprintf("%s switches from %s to %s; its instances will be re-keyed", target.Name, b, t)
+	}
+}
+
+func expansion(r *Resource) string {
+	if _, ok := r.Attributes["count"]; ok {
+		return "count"
+	}
+	if _, ok := r.Attributes["for_each"]; ok {
+		return "for_each"
+	}
+	return ""
+}
+
+func preventDestroy(r *Resource) cty.Value {
+	lifecycle := r.Blocks["lifecycle"]
+	if len(lifecycle) == 0 {
+		return cty.False
+	}
+	v, ok := lifecycle[0].Attributes["prevent_destroy"]
+	if !ok || v.IsNull() || !v.IsKnown() || v.Type() != cty.Bool {
+		return cty.False
+	}
+	return v
+}
+
+func formatBool(v cty.Value) string {
+	if v.True() {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,354 @@
+package tfdiff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// diffConfigs diffs two versions of main.tf.
+func diffConfigs(t *testing.T, d *Differ, base, target string) DiffResult {
+	t.Helper()
+	return d.Diff(parseResources(t, base), parseResources(t, target))
+}
+
+func TestDiffVariableDefault(t *testing.T) {
+	config := func(def string) string {
+		return `
+variable "ami" {
+  default = "` + def + `"
+}
+variable "unused" {
+  default = "` + def + `"
+}
+resource "aws_instance" "a" {
+  ami = var.ami
+}
+resource "aws_instance" "b" {
+  ami = "ami-fixed"
+}
+locals {
+  name = "web-${var.ami}"
+}
+resource "aws_eip" "a" {
+  tags = {
+    Name = local.name
+  }
+}
+`
+	}
+	result := diffConfigs(t, &Differ{}, config("ami-1"), config("ami-2"))
+	if want := []string{"aws_eip.a", "aws_instance.a"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+}
+
+func TestDiffModuleVariableDefault(t *testing.T) {
+	module := func(def string) File {
+		return File{Name: "modules/m/main.tf", Content: []byte(`
+variable "size" {
+  default = ` + def + `
+}
+resource "aws_ebs_volume" "v" {
+  size = var.size
+}
+`)}
+	}
+	root := File{Name: "main.tf", Content: []byte(`
+module "m" {
+  source = "./modules/m"
+}
+`)}
+	parse := func(def string) map[string]*Resource {
+		p := &Parser{LoadModule: func(dir string) ([]File, error) {
+			return []File{module(def)}, nil
+		}}
+		resources, err := p.Parse([]File{root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+	result := (&Differ{}).Diff(parse("10"), parse("20"))
+	if want := []string{"module.m.aws_ebs_volume.v"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+}
+
+func TestDiffProvisioner(t *testing.T) {
+	config := func(command, inline string) string {
+		return `
+resource "null_resource" "a" {
+  provisioner "local-exec" {
+    command = "` + command + ` ${self.id}"
+  }
+  provisioner "remote-exec" {
+    inline = ["` + inline + `"]
+    connection {
+      host     = self.public_ip
+      password = "secret"
+    }
+  }
+}
+`
+	}
+	d := &Differ{}
+	base := config("echo", "uptime")
+	if result := diffConfigs(t, d, base, base); len(result.Modified) > 0 {
+		t.Errorf("Modified = %v for the same provisioners", result.Modified)
+	}
+	for _, target := range []string{config("echo created", "uptime"), config("echo", "reboot")} {
+		result := diffConfigs(t, d, base, target)
+		if want := []string{"null_resource.a"}; !reflect.DeepEqual(result.Modified, want) {
+			t.Errorf("Modified = %v, want %v for\n%s", result.Modified, want, target)
+		}
+	}
+}
+
+func TestDiffResourceAndDataSource(t *testing.T) {
+	base := `
+resource "aws_x" "y" {
+  a = 1
+}
+data "aws_x" "y" {
+  a = 1
+}
+`
+	resources := parseResources(t, base)
+	if r, d := resources["aws_x.y"], resources["data.aws_x.y"]; r == nil || d == nil || r == d {
+		t.Fatalf("aws_x.y and data.aws_x.y aren't tracked apart: %v", resources)
+	}
+
+	d := &Differ{}
+	result := diffConfigs(t, d, base, `
+resource "aws_x" "y" {
+  a = 1
+}
+data "aws_x" "y" {
+  a = 2
+}
+`)
+	if want := []string{"data.aws_x.y"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+
+	result = diffConfigs(t, d, base, `
+data "aws_x" "y" {
+  a = 1
+}
+`)
+	if want := []string{"aws_x.y"}; !reflect.DeepEqual(result.Removed, want) {
+		t.Errorf("Removed = %v, want %v", result.Removed, want)
+	}
+}
+
+func TestDiffLineEndings(t *testing.T) {
+	lf := `
+resource "aws_iam_policy" "p" {
+  description = "multi\nline"
+  policy      = <<EOF
+{
+  "Version": "2012-10-17"
+}
+EOF
+}
+`
+	crlf := strings.ReplaceAll(lf, "\n", "\r\n")
+	// a file edited on both systems
+	mixed := strings.Replace(crlf, "\r\n", "\n", 3)
+
+	d := &Differ{}
+	for _, target := range []string{crlf, mixed} {
+		if result := diffConfigs(t, d, lf, target); len(result.Modified) > 0 {
+			t.Errorf("Modified = %v for %q", result.Modified, target)
+		}
+	}
+
+	// a change on the CRLF side still counts
+	changed := strings.Replace(crlf, "2012-10-17", "2008-10-17", 1)
+	if result := diffConfigs(t, d, lf, changed); len(result.Modified) != 1 {
+		t.Errorf("Modified = %v for a changed policy", result.Modified)
+	}
+}
+
+func TestDiffModuleForEach(t *testing.T) {
+	config := func(b string) string {
+		return `
+module "vpc" {
+  source   = "./modules/vpc"
+  for_each = {
+    a = "10.0.0.0/16"
+    b = "` + b + `"
+  }
+  cidr = each.value
+}
+module "subnet" {
+  source = "./modules/vpc"
+  count  = 2
+  cidr   = "10.${count.index}.0.0/24"
+}
+`
+	}
+	p := &Parser{LoadModule: func(dir string) ([]File, error) {
+		return []File{{Name: "modules/vpc/main.tf", Content: []byte(`
+variable "cidr" {}
+resource "aws_vpc" "this" {
+  cidr_block = var.cidr
+}
+`)}}, nil
+	}}
+	parse := func(src string) map[string]*Resource {
+		resources, err := p.Parse([]File{{Name: "main.tf", Content: []byte(src)}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resources
+	}
+
+	base := parse(config("10.1.0.0/16"))
+	for _, address := range []string{`module.vpc["a"]`, `module.vpc["b"].aws_vpc.this`, "module.subnet[0]", "module.subnet[1].aws_vpc.this"} {
+		if base[address] == nil {
+			t.Errorf("%s is missing", address)
+		}
+	}
+
+	result := (&Differ{}).Diff(base, parse(config("10.2.0.0/16")))
+	if want := []string{`module.vpc["b"]`, `module.vpc["b"].aws_vpc.this`}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+	if len(result.Added)+len(result.Removed) > 0 {
+		t.Errorf("Added = %v, Removed = %v, want none", result.Added, result.Removed)
+	}
+}
+
+func TestEqualValues(t *testing.T) {
+	ab := []cty.Value{cty.StringVal("a"), cty.StringVal("b")}
+	tests := []struct {
+		a, b  cty.Value
+		equal bool
+	}{
+		{cty.TupleVal(ab), cty.ListVal(ab), true},
+		{cty.TupleVal(ab), cty.SetVal(ab), true},
+		{cty.TupleVal(ab), cty.TupleVal([]cty.Value{cty.StringVal("b"), cty.StringVal("a")}), false},
+		{cty.SetVal(ab), cty.TupleVal([]cty.Value{cty.StringVal("b"), cty.StringVal("a")}), true},
+		{cty.TupleVal(ab), cty.TupleVal(append(ab, cty.StringVal("c"))), false},
+		{cty.TupleVal(ab), cty.TupleVal(ab[:1]), false},
+		{cty.ObjectVal(map[string]cty.Value{"a": cty.NumberIntVal(1)}), cty.MapVal(map[string]cty.Value{"a": cty.NumberIntVal(1)}), true},
+		{cty.ObjectVal(map[string]cty.Value{"a": cty.NumberIntVal(1)}), cty.ObjectVal(map[string]cty.Value{"a": cty.NumberIntVal(2)}), false},
+		{cty.MustParseNumberVal("1"), cty.MustParseNumberVal("1.0"), true},
+		{cty.NullVal(cty.String), cty.NullVal(cty.Number), true},
+		{cty.NullVal(cty.String), cty.StringVal(""), false},
+		{cty.UnknownVal(cty.String), cty.UnknownVal(cty.String), true},
+		{cty.UnknownVal(cty.String), cty.StringVal("a"), false},
+		{cty.StringVal("1"), cty.NumberIntVal(1), false},
+	}
+	d := &Differ{}
+	for _, tt := range tests {
+		if got := d.equalValues(tt.a, tt.b); got != tt.equal {
+			t.Errorf("equalValues(%#v, %#v) = %t, want %t", tt.a, tt.b, got, tt.equal)
+		}
+	}
+}
+
+func TestDiffLists(t *testing.T) {
+	config := func(zones string) string {
+		return `
+resource "aws_subnet" "a" {
+  zones = ` + zones + `
+}
+`
+	}
+	tests := []struct {
+		zones       string
+		ignoreOrder bool
+		modified    bool
+	}{
+		{`["a", "b"]`, false, false},
+		{`tolist(["a", "b"])`, false, false},
+		{`toset(["b", "a"])`, false, false},
+		{`["a", "b", "c"]`, false, true},
+		{`["a"]`, false, true},
+		{`["b", "a"]`, false, true},
+		{`["b", "a"]`, true, false},
+	}
+	for _, tt := range tests {
+		d := &Differ{IgnoreOrder: tt.ignoreOrder}
+		result := diffConfigs(t, d, config(`["a", "b"]`), config(tt.zones))
+		if got := len(result.Modified) > 0; got != tt.modified {
+			t.Errorf("[\"a\", \"b\"] to %s (IgnoreOrder %t): modified = %t, want %t", tt.zones, tt.ignoreOrder, got, tt.modified)
+		}
+	}
+}
+
+func TestDiffRepeatedBlocks(t *testing.T) {
+	config := func(port string) string {
+		return `
+resource "aws_network_acl" "a" {
+  rule {
+    port = 22
+  }
+  rule {
+    port = ` + port + `
+  }
+  rule {
+    port = 443
+  }
+}
+`
+	}
+	d := &Differ{}
+	base := parseResources(t, config("80"))
+	target := parseResources(t, config("8080"))
+
+	result := d.Diff(base, target)
+	if want := []string{"aws_network_acl.a"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+	if got, want := d.AttributeChanges(base["aws_network_acl.a"], target["aws_network_acl.a"]), []string{"rule[1].port"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AttributeChanges() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffConditional(t *testing.T) {
+	config := func(prod, large, small string) string {
+		return `
+variable "prod" {
+  default = ` + prod + `
+}
+resource "aws_instance" "a" {
+  instance_type = var.prod ? "` + large + `" : "` + small + `"
+}
+`
+	}
+	d := &Differ{}
+
+	// prod and non-prod pick different branches
+	result := diffConfigs(t, d, config("false", "m5.large", "t3.micro"), config("true", "m5.large", "t3.micro"))
+	if want := []string{"aws_instance.a"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+
+	// both branches evaluate to the same value
+	result = diffConfigs(t, d, config("false", "t3.micro", "t3.micro"), config("true", "t3.micro", "t3.micro"))
+	if len(result.Modified) > 0 {
+		t.Errorf("Modified = %v for branches of the same value", result.Modified)
+	}
+
+	// the condition can't be known, so the source text is compared
+	unknown := func(large string) string {
+		return `
+resource "aws_instance" "a" {
+  instance_type = aws_instance.b.id == "" ? "` + large + `" : "t3.micro"
+}
+`
+	}
+	result = diffConfigs(t, d, unknown("m5.large"), unknown("m5.xlarge"))
+	if want := []string{"aws_instance.a"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v with an unknown condition", result.Modified, want)
+	}
+	if result := diffConfigs(t, d, unknown("m5.large"), unknown("m5.large")); len(result.Modified) > 0 {
+		t.Errorf("Modified = %v for the same unknown conditional", result.Modified)
+	}
+}
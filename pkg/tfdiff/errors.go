@@ -0,0 +1,55 @@
+package tfdiff
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/hcl/v2"
+)
+
+// ErrNotARepo is returned, wrapped with the directory, when a directory
+// isn't in a git repository. Callers can test for it with errors.Is.
+var ErrNotARepo = errors.New("not a git repository")
+
+// ErrNoFiles is returned, wrapped with the directory, when neither side has
+// any configuration files, which usually means the wrong directory rather
+// than a clean diff.
+var ErrNoFiles = errors.New("no terraform files found")
+
+// ParseError is returned when a file can't be parsed or holds a block that
+// can't be decoded. Callers can get at it with errors.As.
+type ParseError struct {
+	File        string
+	Diagnostics hcl.Diagnostics
+}
+
+func (e *ParseError) Error() string {
+	return e.Diagnostics.Error()
+}
+
+func newParseError(rng hcl.Range, summary, detail string) *ParseError {
+	return &ParseError{
+		File: rng.Filename,
+		Diagnostics: hcl.Diagnostics{{
+			Severity: hcl.DiagError,
+			Summary:  summary,
+			Detail:   detail,
+			Subject:  rng.Ptr(),
+		}},
+	}
+}
+
+// RefError is returned when a revision, such as the base, can't be
+// resolved. Callers can get at it with errors.As.
+type RefError struct {
+	Ref string
+	Err error
+}
+
+func (e *RefError) Error() string {
+	return fmt.Sprintf("unknown revision %s: %s", e.Ref, e.Err)
+}
+
+func (e *RefError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,32 @@
+package tfdiff
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestDiffRevisionErrors(t *testing.T) {
+	if _, err := DiffRevision("master", t.TempDir()); !errors.Is(err, ErrNotARepo) {
+		t.Errorf("outside a repository: got %v, want ErrNotARepo", err)
+	}
+
+	dir := initRepository(t, map[string]string{"main.tf": `resource "a_b" "c" {}`, "docs/README.md": "docs"})
+
+	_, err := DiffRevision("no-such-branch", dir)
+	var refErr *RefError
+	if !errors.As(err, &refErr) || refErr.Ref != "no-such-branch" {
+		t.Errorf("unknown base: got %v, want a *RefError for no-such-branch", err)
+	}
+
+	if _, err := DiffRevision("master", filepath.Join(dir, "docs")); !errors.Is(err, ErrNoFiles) {
+		t.Errorf("no configuration: got %v, want ErrNoFiles", err)
+	}
+
+	writeFiles(t, dir, map[string]string{"main.tf": `resource "a_b" {}`})
+	_, err = DiffRevision("master", dir)
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.File != "main.tf" {
+		t.Errorf("invalid configuration: got %v, want a *ParseError for main.tf", err)
+	}
+}
@@ -0,0 +1,256 @@
+package tfdiff
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/ext/typeexpr"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+type variable struct {
+	Type     cty.Type
+	Default  cty.Value
+	Optional *optionalAttrs
+}
+
+// EnvVariables returns the raw variable values set through TF_VAR_
+// environment variables.
+func EnvVariables() map[string]string {
+	vars := make(map[string]string)
+	for _, e := range os.Environ() {
+		if !strings.HasPrefix(e, "TF_VAR_") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(e, "TF_VAR_"), "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			vars[kv[0]] = kv[1]
+		}
+	}
+	return vars
+}
+
+// evalContext builds the context attributes are evaluated in. Values are
+// layered like terraform does: environment, terraform.tfvars,
+// terraform.tfvars.json, *.auto.tfvars and *.auto.tfvars.json in lexical
+// order, Overrides (in the root module) or module call inputs, then defaults
+// for anything left unset. Every value is converted to the declared type of its variable.
+// Locals are evaluated in the context too, see evalLocals.
+func (p *Parser) evalContext(bodies []*hclsyntax.Body, tfvars []File, raw map[string]string, inputs map[string]cty.Value) *hcl.EvalContext {
+	declared := declaredVariables(bodies)
+
+	values := make(map[string]cty.Value)
+	for name, value := range raw {
+		if v, ok := declared[name]; ok {
+			values[name] = p.rawValue(name, value, v.Type)
+		}
+	}
+
+	sort.SliceStable(tfvars, func(i, j int) bool {
+		oi, oj := tfvarsOrder(tfvars[i].Name), tfvarsOrder(tfvars[j].Name)
+		if oi != oj {
+			return oi < oj
+		}
+		return path.Base(tfvars[i].Name) < path.Base(tfvars[j].Name)
+	})
+	for _, f := range tfvars {
+		for name, v := range p.tfvarsValues(f) {
+			values[name] = v
+		}
+	}
+	// the root module is the one without inputs
+	if inputs == nil {
+		for name, value := range p.Overrides {
+			if v, ok := declared[name]; ok {
+				values[name] = p.rawValue(name, value, v.Type)
+			} else {
+				p.warn(fmt.Sprintf("variable %q is set but not declared", name))
+			}
+		}
+	}
+	for name, v := range inputs {
+		values[name] = v
+	}
+
+	vars := make(map[string]cty.Value)
+	for name, decl := range declared {
+		v, ok := values[name]
+		if !ok {
+			v = decl.Default
+		}
+		vars[name] = p.coerce(name, decl.Optional.apply(v), decl.Type)
+	}
+
+	ctx := &hcl.EvalContext{
+		Variables: map[string]cty.Value{
+			"var": cty.ObjectVal(vars),
+		},
+		Functions: functions(),
+	}
+	evalLocals(bodies, ctx)
+	return ctx
+}
+
+// evalLocals adds the locals of bodies to ctx. Locals may refer to each
+// other in any order, so they are evaluated until no more resolve. The rest,
+// such as those referring to resources, stay unknown, and attributes using
+// them are compared by their source text.
+func evalLocals(bodies []*hclsyntax.Body, ctx *hcl.EvalContext) {
+	exprs := make(map[string]hcl.Expression)
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "locals" {
+				continue
+			}
+			for name, attr := range block.Body.Attributes {
+				exprs[name] = attr.Expr
+			}
+		}
+	}
+	if len(exprs) == 0 {
+		return
+	}
+
+	values := make(map[string]cty.Value)
+	for name, _ := range exprs {
+		values[name] = cty.DynamicVal
+	}
+
+	for resolved := true; resolved; {
+		resolved = false
+		ctx.Variables["local"] = cty.ObjectVal(values)
+		for name, expr := range exprs {
+			if values[name].IsWhollyKnown() {
+				continue
+			}
+			v, diags := expr.Value(ctx)
+			if diags.HasErrors() || !v.IsWhollyKnown() {
+				continue
+			}
+			values[name] = unmark(v)
+			resolved = true
+		}
+	}
+	ctx.Variables["local"] = cty.ObjectVal(values)
+}
+
+func declaredVariables(bodies []*hclsyntax.Body) map[string]variable {
+	declared := make(map[string]variable)
+
+	for _, body := range bodies {
+		for _, block := range body.Blocks {
+			if block.Type != "variable" || len(block.Labels) != 1 {
+				continue
+			}
+
+			v := variable{Type: cty.DynamicPseudoType, Default: cty.NilVal}
+			if attr, ok := block.Body.Attributes["type"]; ok {
+				if t, diags := typeexpr.TypeConstraint(attr.Expr); !diags.HasErrors() {
+					v.Type = t
+				} else {
+					v.Optional = optionalType(attr.Expr)
+				}
+			}
+			if attr, ok := block.Body.Attributes["default"]; ok {
+				if d, diags := attr.Expr.Value(nil); !diags.HasErrors() {
+					v.Default = d
+				}
+			}
+
+			declared[block.Labels[0]] = v
+		}
+	}
+
+	return declared
+}
+
+func tfvarsOrder(name string) int {
+	switch path.Base(name) {
+	case "terraform.tfvars":
+		return 0
+	case "terraform.tfvars.json":
+		return 1
+	}
+	return 2
+}
+
+func (p *Parser) tfvarsValues(f File) map[string]cty.Value {
+	var file *hcl.File
+	var diags hcl.Diagnostics
+	if strings.HasSuffix(f.Name, ".json") {
+		file, diags = hcljson.Parse(f.Content, f.Name)
+	} else {
+		file, diags = hclsyntax.ParseConfig(f.Content, f.Name, hcl.Pos{Line: 1, Column: 1})
+	}
+	if diags.HasErrors() {
+		p.warn(diags.Error())
+		return nil
+	}
+
+	attrs, diags := file.Body.JustAttributes()
+	if diags.HasErrors() {
+		p.warn(diags.Error())
+		return nil
+	}
+
+	values := make(map[string]cty.Value)
+	for name, attr := range attrs {
+		v, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			p.warn(diags.Error())
+			continue
+		}
+		values[name] = v
+	}
+
+	return values
+}
+
+// Like terraform, raw values of primitive variables are taken literally and
+// anything else is parsed as an HCL expression.
+func (p *Parser) rawValue(name, raw string, t cty.Type) cty.Value {
+	if t.IsPrimitiveType() || t == cty.DynamicPseudoType {
+		return cty.StringVal(raw)
+	}
+
+	expr, diags := hclsyntax.ParseExpression([]byte(raw), name, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		p.warn(fmt.Sprintf("variable %q: %s", name, diags.Error()))
+		return cty.UnknownVal(t)
+	}
+
+	v, diags := expr.Value(nil)
+	if diags.HasErrors() {
+		p.warn(fmt.Sprintf("variable %q: %s", name, diags.Error()))
+		return cty.UnknownVal(t)
+	}
+
+	return v
+}
+
+// A variable without a value stays unknown, so attributes derived from it
+// compare the way they did before evaluation was supported.
+func (p *Parser) coerce(name string, v cty.Value, t cty.Type) cty.Value {
+	if v == cty.NilVal {
+		return cty.UnknownVal(t)
+	}
+
+	c, err := convert.Convert(v, t)
+	if err != nil {
+		p.warn(fmt.Sprintf("variable %q: invalid value for type %s: %s", name, typeexpr.TypeString(t), err))
+		return cty.UnknownVal(t)
+	}
+
+	return c
+}
+
+func (p *Parser) warn(msg string) {
+	p.Warnings = append(p.Warnings, msg)
+}
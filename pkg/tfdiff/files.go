@@ -0,0 +1,132 @@
+package tfdiff
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/util"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// FilePatterns match the names of the files terraform reads from a
+// directory: configuration and the tfvars files it loads automatically.
+var FilePatterns = []string{"*.tf", "*.tf.json", "terraform.tfvars", "terraform.tfvars.json", "*.auto.tfvars", "*.auto.tfvars.json"}
+
+// ReadFiles reads the files matching FilePatterns directly in the directory
+// dir of fs, which is empty or ends in a slash. The patterns are only
+// matched against file names, so directory names containing glob
+// characters work too.
+func ReadFiles(fs billy.Filesystem, dir string) ([]File, error) {
+	d := dir
+	if d == "" {
+		d = "."
+	}
+	entries, err := fs.ReadDir(d)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	for _, pattern := range FilePatterns {
+		for _, e := range entries {
+			if ok, _ := path.Match(pattern, e.Name()); ok && !e.IsDir() {
+				matches = append(matches, dir+e.Name())
+			}
+		}
+	}
+
+	var files []File
+	for _, f := range matches {
+		c, err := util.ReadFile(fs, f)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, File{Name: f, Content: c})
+	}
+	return files, nil
+}
+
+// ReadTree reads the files in dir like read, such as ReadFiles, and the
+// .tf and .tf.json files of its subdirectories. Hidden directories, such as
+// .terraform and .git, are skipped. The tfvars files of subdirectories
+// aren't read, since they set the variables of another root module.
+func ReadTree(fs billy.Filesystem, dir string, read func(dir string) ([]File, error)) ([]File, error) {
+	files, err := read(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		d := dir
+		if d == "" {
+			d = "."
+		}
+		entries, err := fs.ReadDir(d)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		var names []string
+		for _, e := range entries {
+			if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				names = append(names, e.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			sub := dir + name + "/"
+			subFiles, err := read(sub)
+			if err != nil {
+				return err
+			}
+			for _, f := range subFiles {
+				if strings.HasSuffix(f.Name, ".tf") || strings.HasSuffix(f.Name, ".tf.json") {
+					files = append(files, f)
+				}
+			}
+			if err := walk(sub); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// ResolveRevision resolves rev in repo. Branches, and HEAD, only exist as
+// remote-tracking refs in clones made like tfdiff's, so origin/rev is tried
+// too.
+func ResolveRevision(repo *git.Repository, rev string) (*plumbing.Hash, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err == nil {
+		return hash, nil
+	}
+
+	if h, e := repo.ResolveRevision(plumbing.Revision("origin/" + rev)); e == nil {
+		return h, nil
+	}
+
+	return nil, err
+}
+
+// moduleDir turns a directory given to LoadModule into the path ReadFiles
+// takes.
+func moduleDir(dir string) string {
+	if dir == "." {
+		return ""
+	}
+	return dir + "/"
+}
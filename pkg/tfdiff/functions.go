@@ -0,0 +1,277 @@
+package tfdiff
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"net"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/function"
+	"github.com/zclconf/go-cty/cty/function/stdlib"
+)
+
+// functions returns the terraform built-in functions that can be evaluated
+// without a provider or the filesystem. They are taken from the cty standard
+// library, plus cidrhost, cidrnetmask, cidrsubnet, sensitive and
+// nonsensitive:
+//
+//	numeric:     abs, ceil, floor, log, max, min, parseint, pow, signum
+//	string:      chomp, format, formatlist, indent, join, lower, regex,
+//	             regexall, replace, split, strrev, substr, title, trim,
+//	             trimprefix, trimspace, trimsuffix, upper
+//	collection:  chunklist, coalesce, coalescelist, compact, concat,
+//	             contains, distinct, element, flatten, keys, length, lookup,
+//	             merge, range, reverse, setintersection, setproduct,
+//	             setsubtract, setunion, slice, sort, values, zipmap
+//	encoding:    csvdecode, jsondecode, jsonencode
+//	date/time:   formatdate, timeadd
+//	conversion:  tobool, tolist, tomap, tonumber, toset, tostring
+//	network:     cidrhost, cidrnetmask, cidrsubnet
+//	sensitivity: nonsensitive, sensitive
+//
+// Anything else, including file and provider-defined functions, stays
+// unknown like an unresolved reference. replace only does literal
+// substitution, without terraform's /regex/ form.
+func functions() map[string]function.Function {
+	return map[string]function.Function{
+		"abs":             stdlib.AbsoluteFunc,
+		"ceil":            stdlib.CeilFunc,
+		"chomp":           stdlib.ChompFunc,
+		"chunklist":       stdlib.ChunklistFunc,
+		"cidrhost":        cidrHostFunc,
+		"cidrnetmask":     cidrNetmaskFunc,
+		"cidrsubnet":      cidrSubnetFunc,
+		"coalesce":        stdlib.CoalesceFunc,
+		"coalescelist":    stdlib.CoalesceListFunc,
+		"compact":         stdlib.CompactFunc,
+		"concat":          stdlib.ConcatFunc,
+		"contains":        stdlib.ContainsFunc,
+		"csvdecode":       stdlib.CSVDecodeFunc,
+		"distinct":        stdlib.DistinctFunc,
+		"element":         stdlib.ElementFunc,
+		"flatten":         stdlib.FlattenFunc,
+		"floor":           stdlib.FloorFunc,
+		"format":          stdlib.FormatFunc,
+		"formatdate":      stdlib.FormatDateFunc,
+		"formatlist":      stdlib.FormatListFunc,
+		"indent":          stdlib.IndentFunc,
+		"join":            stdlib.JoinFunc,
+		"jsondecode":      stdlib.JSONDecodeFunc,
+		"jsonencode":      stdlib.JSONEncodeFunc,
+		"keys":            stdlib.KeysFunc,
+		"length":          stdlib.LengthFunc,
+		"log":             stdlib.LogFunc,
+		"lookup":          stdlib.LookupFunc,
+		"lower":           stdlib.LowerFunc,
+		"max":             stdlib.MaxFunc,
+		"merge":           stdlib.MergeFunc,
+		"min":             stdlib.MinFunc,
+		"nonsensitive":    nonsensitiveFunc,
+		"parseint":        stdlib.ParseIntFunc,
+		"pow":             stdlib.PowFunc,
+		"range":           stdlib.RangeFunc,
+		"regex":           stdlib.RegexFunc,
+		"regexall":        stdlib.RegexAllFunc,
+		"replace":         stdlib.ReplaceFunc,
+		"reverse":         stdlib.ReverseListFunc,
+		"sensitive":       sensitiveFunc,
+		"setintersection": stdlib.SetIntersectionFunc,
+		"setproduct":      stdlib.SetProductFunc,
+		"setsubtract":     stdlib.SetSubtractFunc,
+		"setunion":        stdlib.SetUnionFunc,
+		"signum":          stdlib.SignumFunc,
+		"slice":           stdlib.SliceFunc,
+		"sort":            stdlib.SortFunc,
+		"split":           stdlib.SplitFunc,
+		"strrev":          stdlib.ReverseFunc,
+		"substr":          stdlib.SubstrFunc,
+		"timeadd":         stdlib.TimeAddFunc,
+		"title":           stdlib.TitleFunc,
+		"tobool":          stdlib.MakeToFunc(cty.Bool),
+		"tolist":          stdlib.MakeToFunc(cty.List(cty.DynamicPseudoType)),
+		"tomap":           stdlib.MakeToFunc(cty.Map(cty.DynamicPseudoType)),
+		"tonumber":        stdlib.MakeToFunc(cty.Number),
+		"toset":           stdlib.MakeToFunc(cty.Set(cty.DynamicPseudoType)),
+		"tostring":        stdlib.MakeToFunc(cty.String),
+		"trim":            stdlib.TrimFunc,
+		"trimprefix":      stdlib.TrimPrefixFunc,
+		"trimspace":       stdlib.TrimSpaceFunc,
+		"trimsuffix":      stdlib.TrimSuffixFunc,
+		"upper":           stdlib.UpperFunc,
+		"values":          stdlib.ValuesFunc,
+		"zipmap":          stdlib.ZipmapFunc,
+	}
+}
+
+var cidrHostFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "hostnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, ones, bits, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		hostnum, _ := args[1].AsBigFloat().Int(nil)
+		if hostnum.Sign() < 0 || hostnum.BitLen() > bits-ones {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix %s has no host %s", args[0].AsString(), hostnum)
+		}
+
+		return cty.StringVal(intToIP(base.Or(base, hostnum), bits).String()), nil
+	},
+})
+
+var cidrNetmaskFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		_, network, err := net.ParseCIDR(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+		if len(network.Mask) != net.IPv4len {
+			return cty.UnknownVal(cty.String), fmt.Errorf("cidrnetmask only supports IPv4 prefixes")
+		}
+
+		return cty.StringVal(net.IP(network.Mask).String()), nil
+	},
+})
+
+var cidrSubnetFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "prefix", Type: cty.String},
+		{Name: "newbits", Type: cty.Number},
+		{Name: "netnum", Type: cty.Number},
+	},
+	Type: function.StaticReturnType(cty.String),
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		base, ones, bits, err := parsePrefix(args[0].AsString())
+		if err != nil {
+			return cty.UnknownVal(cty.String), err
+		}
+
+		newbits, _ := args[1].AsBigFloat().Int64()
+		netnum, _ := args[2].AsBigFloat().Int(nil)
+		if newbits < 0 || ones+int(newbits) > bits {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix %s can't be extended by %d bits", args[0].AsString(), newbits)
+		}
+		if netnum.Sign() < 0 || netnum.BitLen() > int(newbits) {
+			return cty.UnknownVal(cty.String), fmt.Errorf("prefix extension of %d bits has no network number %s", newbits, netnum)
+		}
+
+		ones += int(newbits)
+		base.Or(base, netnum.Lsh(netnum, uint(bits-ones)))
+
+		return cty.StringVal(fmt.Sprintf("%s/%d", intToIP(base, bits), ones)), nil
+	},
+})
+
+// Sensitivity only changes how terraform displays a value, not the value
+// itself, so decoded values are unmarked and comparisons never see it.
+const sensitiveMark = "sensitive"
+
+var sensitiveFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType, AllowUnknown: true, AllowNull: true, AllowMarked: true},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		return args[0].Type(), nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return args[0].Mark(sensitiveMark), nil
+	},
+})
+
+var nonsensitiveFunc = function.New(&function.Spec{
+	Params: []function.Parameter{
+		{Name: "value", Type: cty.DynamicPseudoType, AllowUnknown: true, AllowNull: true, AllowMarked: true},
+	},
+	Type: func(args []cty.Value) (cty.Type, error) {
+		return args[0].Type(), nil
+	},
+	Impl: func(args []cty.Value, retType cty.Type) (cty.Value, error) {
+		return unmark(args[0]), nil
+	},
+})
+
+func unmark(v cty.Value) cty.Value {
+	v, _ = v.UnmarkDeep()
+	return v
+}
+
+func parsePrefix(prefix string) (*big.Int, int, int, error) {
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	ones, bits := network.Mask.Size()
+	ip := network.IP.To16()
+	if bits == 32 {
+		ip = network.IP.To4()
+	}
+
+	return new(big.Int).SetBytes(ip), ones, bits, nil
+}
+
+func intToIP(n *big.Int, bits int) net.IP {
+	ip := make(net.IP, bits/8)
+	b := n.Bytes()
+	copy(ip[len(ip)-len(b):], b)
+	return ip
+}
+
+// unnamespaceFunctions rewrites provider function calls such as
+// provider::aws::arn_parse(...), which this version of HCL can't parse, into
+// calls of an unknown function named provider__aws__arn_parse. Only the
+// colons change, so ranges into the original content stay valid, and the
+// calls evaluate to unknown values, which are compared by their text.
+func unnamespaceFunctions(content []byte) ([]byte, bool) {
+	if !bytes.Contains(content, []byte("::")) {
+		return content, false
+	}
+
+	tokens, diags := hclsyntax.LexConfig(content, "", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return content, false
+	}
+
+	var rewritten []byte
+	for i := 0; i+7 < len(tokens); i++ {
+		if tokens[i].Type != hclsyntax.TokenIdent || string(tokens[i].Bytes) != "provider" {
+			continue
+		}
+		call := true
+		for j, want := range []hclsyntax.TokenType{hclsyntax.TokenColon, hclsyntax.TokenColon, hclsyntax.TokenIdent, hclsyntax.TokenColon, hclsyntax.TokenColon, hclsyntax.TokenIdent, hclsyntax.TokenOParen} {
+			t := tokens[i+1+j]
+			// the name can't have spaces in it
+			if t.Type != want || want != hclsyntax.TokenOParen && t.Range.Start.Byte != tokens[i+j].Range.End.Byte {
+				call = false
+				break
+			}
+		}
+		if !call {
+			continue
+		}
+
+		if rewritten == nil {
+			rewritten = append([]byte(nil), content...)
+		}
+		for _, j := range []int{1, 2, 4, 5} {
+			rewritten[tokens[i+j].Range.Start.Byte] = '_'
+		}
+	}
+
+	if rewritten == nil {
+		return content, false
+	}
+	return rewritten, true
+}
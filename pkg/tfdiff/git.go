@@ -0,0 +1,129 @@
+package tfdiff
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// DiffRevision compares the configuration in dir, a directory of a git
+// working tree, with the same directory at the base revision, such as a
+// branch, a tag or a commit hash. Local modules are read on both sides and
+// the warnings of parsing either side are part of the result.
+//
+// The errors wrap ErrNotARepo, ErrNoFiles, a *RefError or a *ParseError
+// where they apply.
+func DiffRevision(base, dir string) (DiffResult, error) {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err == git.ErrRepositoryNotExists {
+		return DiffResult{}, fmt.Errorf("%s: %w", dir, ErrNotARepo)
+	}
+	if err != nil {
+		return DiffResult{}, err
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	root := w.Filesystem.Root()
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	hash, err := ResolveRevision(repo, base)
+	if err != nil {
+		return DiffResult{}, &RefError{Ref: base, Err: err}
+	}
+	commit, err := repo.CommitObject(*hash)
+	if err != nil {
+		return DiffResult{}, err
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return DiffResult{}, err
+	}
+	baseFS, err := treeFilesystem(tree)
+	if err != nil {
+		return DiffResult{}, err
+	}
+
+	var warnings []string
+	var files int
+	parse := func(fs billy.Filesystem) (map[string]*Resource, error) {
+		config, err := ReadFiles(fs, moduleDir(filepath.ToSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		files += len(config)
+		p := &Parser{Variables: EnvVariables(), LoadModule: func(dir string) ([]File, error) {
+			return ReadFiles(fs, moduleDir(dir))
+		}}
+		resources, err := p.Parse(config)
+		warnings = append(warnings, p.Warnings...)
+		return resources, err
+	}
+
+	baseResources, err := parse(baseFS)
+	if err != nil {
+		return DiffResult{}, fmt.Errorf("%s: %w", base, err)
+	}
+	targetResources, err := parse(osfs.New(root))
+	if err != nil {
+		return DiffResult{}, err
+	}
+	if files == 0 {
+		return DiffResult{}, fmt.Errorf("%s: %w", dir, ErrNoFiles)
+	}
+
+	result := Diff(baseResources, targetResources)
+	result.Warnings = append(result.Warnings, warnings...)
+	result.Sort()
+	return result, nil
+}
+
+// treeFilesystem copies the files of tree matching FilePatterns into
+// memory, so both sides are read the same way.
+func treeFilesystem(tree *object.Tree) (billy.Filesystem, error) {
+	fs := memfs.New()
+	err := tree.Files().ForEach(func(f *object.File) error {
+		if !f.Mode.IsFile() || !isConfigFile(path.Base(f.Name)) {
+			return nil
+		}
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		w, err := fs.Create(f.Name)
+		if err != nil {
+			return err
+		}
+		defer w.Close()
+		_, err = io.Copy(w, r)
+		return err
+	})
+	return fs, err
+}
+
+func isConfigFile(name string) bool {
+	for _, pattern := range FilePatterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package tfdiff
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// initRepository makes a repository in a temporary directory with files
+// committed, and returns its directory.
+func initRepository(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, dir, files)
+
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddGlob("."); err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "t", Email: "t@example.com", When: time.Now()}
+	if _, err := w.Commit("initial", &git.CommitOptions{Author: sig}); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiffRevision(t *testing.T) {
+	dir := initRepository(t, map[string]string{
+		"infra/main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+resource "aws_instance" "a" {
+  ami = "ami-1"
+}
+resource "aws_instance" "b" {}
+`,
+		"infra/modules/vpc/main.tf": `resource "aws_vpc" "this" { cidr_block = "10.0.0.0/16" }`,
+		"infra/extra.tf.json":       `{"resource": {"aws_s3_bucket": {"logs": {"bucket": "logs"}}}}`,
+		"README.md":                 "not configuration",
+	})
+	writeFiles(t, dir, map[string]string{
+		"infra/main.tf": `
+module "vpc" {
+  source = "./modules/vpc"
+}
+resource "aws_instance" "a" {
+  ami = "ami-2"
+}
+resource "aws_instance" "c" {}
+`,
+		"infra/modules/vpc/main.tf": `resource "aws_vpc" "this" { cidr_block = "10.1.0.0/16" }`,
+	})
+
+	result, err := DiffRevision("master", filepath.Join(dir, "infra"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"aws_instance.c"}; !reflect.DeepEqual(result.Added, want) {
+		t.Errorf("Added = %v, want %v", result.Added, want)
+	}
+	if want := []string{"aws_instance.b"}; !reflect.DeepEqual(result.Removed, want) {
+		t.Errorf("Removed = %v, want %v", result.Removed, want)
+	}
+	if want := []string{"aws_instance.a", "module.vpc.aws_vpc.this"}; !reflect.DeepEqual(result.Modified, want) {
+		t.Errorf("Modified = %v, want %v", result.Modified, want)
+	}
+}
@@ -0,0 +1,35 @@
+package tfdiff
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+const ignoreMarker = "tfdiff:ignore"
+
+// ignoredLines returns the lines on which a block marked with a
+// tfdiff:ignore comment may start: the line of the comment itself, for a
+// trailing comment after the opening brace, and the line after it.
+func ignoredLines(src []byte, filename string) map[int]bool {
+	if !strings.Contains(string(src), ignoreMarker) {
+		return nil
+	}
+
+	lines := make(map[int]bool)
+	tokens, _ := hclsyntax.LexConfig(src, filename, hcl.InitialPos)
+	for _, t := range tokens {
+		if t.Type != hclsyntax.TokenComment {
+			continue
+		}
+
+		text := strings.TrimLeft(string(t.Bytes), "#/* \t")
+		if strings.HasPrefix(strings.TrimSpace(text), ignoreMarker) {
+			lines[t.Range.Start.Line] = true
+			lines[t.Range.Start.Line+1] = true
+		}
+	}
+
+	return lines
+}
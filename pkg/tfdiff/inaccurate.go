@@ -0,0 +1,66 @@
+package tfdiff
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// inaccuracies lists the constructs of a resource body whose values can't be
+// determined statically. Those are compared by their source text, so changes
+// to what they refer to go unreported.
+func inaccuracies(body *hclsyntax.Body, ctx *hcl.EvalContext) []string {
+	found := make(map[string]bool)
+	collectInaccuracies(body, ctx, instances(body.Attributes, ctx), found)
+
+	var reasons []string
+	for r, _ := range found {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+
+	return reasons
+}
+
+func collectInaccuracies(body *hclsyntax.Body, ctx *hcl.EvalContext, contexts map[string]*hcl.EvalContext, found map[string]bool) {
+	for name, attr := range body.Attributes {
+		// provider references are compared by their text
+		if name == "provider" || name == "providers" {
+			continue
+		}
+
+		if v, ok := instanceValue(attr.Expr, contexts); ok && v.IsWhollyKnown() {
+			continue
+		}
+
+		v, diags := attr.Expr.Value(ctx)
+		if !diags.HasErrors() && v.IsWhollyKnown() {
+			continue
+		}
+
+		call := false
+		hclsyntax.VisitAll(attr.Expr, func(n hclsyntax.Node) hcl.Diagnostics {
+			if _, ok := n.(*hclsyntax.FunctionCallExpr); ok {
+				call = true
+			}
+			return nil
+		})
+		if call {
+			found["function call"] = true
+		} else {
+			found["unresolved reference"] = true
+		}
+	}
+
+	for _, b := range body.Blocks {
+		switch b.Type {
+		case "lifecycle":
+			// compared by source text
+			continue
+		case "dynamic":
+			found["dynamic block"] = true
+		}
+		collectInaccuracies(b.Body, ctx, contexts, found)
+	}
+}
@@ -0,0 +1,99 @@
+package tfdiff
+
+import (
+	"strconv"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// MaxCount is the largest count expanded into instances. Larger counts are
+// treated like unknown ones, rather than allocating an instance each.
+const MaxCount = 10000
+
+// instances returns an evaluation context per instance of a resource whose
+// count or for_each is known statically, keyed by instance key, with count
+// or each set. It returns nil when the resource isn't expanded or its
+// instances can't be determined.
+func instances(attributes hclsyntax.Attributes, ctx *hcl.EvalContext) map[string]*hcl.EvalContext {
+	if attr, ok := attributes["count"]; ok {
+		v, diags := attr.Expr.Value(ctx)
+		v = unmark(v)
+		if diags.HasErrors() || !v.IsKnown() || v.IsNull() || v.Type() != cty.Number {
+			return nil
+		}
+
+		n, _ := v.AsBigFloat().Int64()
+		if n > MaxCount {
+			return nil
+		}
+		contexts := make(map[string]*hcl.EvalContext)
+		for i := int64(0); i < n; i++ {
+			contexts[strconv.FormatInt(i, 10)] = instanceContext(ctx, "count", map[string]cty.Value{
+				"index": cty.NumberIntVal(i),
+			})
+		}
+		return contexts
+	}
+
+	if attr, ok := attributes["for_each"]; ok {
+		v, diags := attr.Expr.Value(ctx)
+		v = unmark(v)
+		if diags.HasErrors() || !v.IsWhollyKnown() || v.IsNull() {
+			return nil
+		}
+
+		contexts := make(map[string]*hcl.EvalContext)
+		switch t := v.Type(); {
+		case t.IsMapType() || t.IsObjectType():
+			for k, ev := range v.AsValueMap() {
+				contexts[k] = instanceContext(ctx, "each", map[string]cty.Value{
+					"key":   cty.StringVal(k),
+					"value": ev,
+				})
+			}
+		case t.IsSetType() && t.ElementType() == cty.String:
+			for _, ev := range v.AsValueSlice() {
+				contexts[ev.AsString()] = instanceContext(ctx, "each", map[string]cty.Value{
+					"key":   ev,
+					"value": ev,
+				})
+			}
+		default:
+			return nil
+		}
+		return contexts
+	}
+
+	return nil
+}
+
+func instanceContext(ctx *hcl.EvalContext, name string, attrs map[string]cty.Value) *hcl.EvalContext {
+	c := ctx.NewChild()
+	c.Variables = map[string]cty.Value{name: cty.ObjectVal(attrs)}
+	return c
+}
+
+// instanceValue evaluates an expression referring to count or each once per
+// instance. The values are kept as an object keyed by instance key, so a
+// change to any instance changes the attribute.
+func instanceValue(expr hcl.Expression, contexts map[string]*hcl.EvalContext) (cty.Value, bool) {
+	referenced := false
+	for _, t := range expr.Variables() {
+		if root := t.RootName(); root == "count" || root == "each" {
+			referenced = true
+		}
+	}
+	if !referenced || contexts == nil {
+		return cty.NilVal, false
+	}
+
+	values := make(map[string]cty.Value)
+	for k, c := range contexts {
+		v, _ := expr.Value(c)
+		values[k] = unmark(v)
+	}
+
+	return cty.ObjectVal(values), true
+}
@@ -0,0 +1,45 @@
+package tfdiff
+
+import (
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+func parseBody(t *testing.T, src string) *hclsyntax.Body {
+	t.Helper()
+	f, diags := hclsyntax.ParseConfig([]byte(src), "main.tf", hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		t.Fatal(diags)
+	}
+	return f.Body.(*hclsyntax.Body)
+}
+
+func TestInstances(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{`count = 3`, 3},
+		{`count = 0`, 0},
+		{`for_each = {a = 1, b = 2}`, 2},
+		{`for_each = toset(["a", "b", "c"])`, 3},
+		{`count = var.unknown`, -1},
+		{`count = 1e9`, -1},
+		{`name = "x"`, -1},
+	}
+	for _, tt := range tests {
+		ctx := &hcl.EvalContext{Functions: functions()}
+		got := instances(parseBody(t, tt.src).Attributes, ctx)
+		if tt.want < 0 {
+			if got != nil {
+				t.Errorf("instances(%s) = %d instances, want nil", tt.src, len(got))
+			}
+			continue
+		}
+		if got == nil || len(got) != tt.want {
+			t.Errorf("instances(%s) = %d instances, want %d", tt.src, len(got), tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package tfdiff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+)
+
+// Block types of the JSON syntax by the number of their labels, at the top
+// level and nested in each block type. Without provider schemas, any other
+// object is an attribute value, so nested blocks of resources compare as
+// objects in .tf.json files.
+var (
+	jsonTopLevel = map[string]int{
+		"resource": 2, "data": 2, "module": 1, "variable": 1, "output": 1,
+		"provider": 1, "locals": 0, "terraform": 0, "moved": 0, "removed": 0,
+	}
+	jsonNested = map[string]map[string]int{
+		"resource":    {"lifecycle": 0, "connection": 0, "provisioner": 1, "dynamic": 1},
+		"data":        {"lifecycle": 0, "dynamic": 1},
+		"lifecycle":   {"precondition": 0, "postcondition": 0},
+		"provisioner": {"connection": 0},
+		"dynamic":     {"content": 0},
+		"terraform":   {"required_providers": 0, "backend": 1, "cloud": 0},
+		"cloud":       {"workspaces": 0},
+		"removed":     {"lifecycle": 0},
+		"output":      {"precondition": 0},
+		"variable":    {"validation": 0},
+	}
+)
+
+// Arguments whose strings are expressions rather than templates, by block
+// type, such as depends_on = ["aws_vpc.main"].
+var jsonExpressions = map[string]map[string]bool{
+	"resource":  {"depends_on": true, "provider": true},
+	"data":      {"depends_on": true, "provider": true},
+	"module":    {"depends_on": true, "providers": true},
+	"output":    {"depends_on": true},
+	"lifecycle": {"ignore_changes": true, "replace_triggered_by": true},
+	"moved":     {"from": true, "to": true},
+	"removed":   {"from": true},
+	"variable":  {"type": true},
+}
+
+// jsonConfig decodes a file in terraform's JSON syntax, such as
+// main.tf.json, with hcl's JSON parser and the block types above as its
+// schema, and writes it in the native syntax, so both are decoded the same
+// way. The layout records where the blocks and attributes are in the JSON
+// file, for relocate.
+func jsonConfig(f File) ([]byte, *jsonLayout, error) {
+	file, diags := hcljson.Parse(f.Content, f.Name)
+	if diags.HasErrors() {
+		return nil, nil, &ParseError{File: f.Name, Diagnostics: diags}
+	}
+
+	w := &jsonWriter{src: f.Content}
+	layout, err := w.body(file.Body, "", "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.b.Bytes(), layout, nil
+}
+
+// jsonLayout holds the JSON source of the attributes and, in order, the
+// blocks of a body jsonConfig wrote.
+type jsonLayout struct {
+	attributes map[string]*hcl.Attribute
+	blocks     []jsonBlock
+}
+
+type jsonBlock struct {
+	block *hcl.Block
+	body  *jsonLayout
+}
+
+type jsonWriter struct {
+	src []byte
+	b   bytes.Buffer
+}
+
+// body writes the attributes and blocks of body, a block of type kind or
+// the file itself when kind is empty.
+func (w *jsonWriter) body(body hcl.Body, kind, indent string) (*jsonLayout, error) {
+	types := jsonNested[kind]
+	if kind == "" {
+		types = jsonTopLevel
+	}
+	schema := &hcl.BodySchema{}
+	for _, typ := range sortedTypes(types) {
+		schema.Blocks = append(schema.Blocks, hcl.BlockHeaderSchema{Type: typ, LabelNames: make([]string, types[typ])})
+	}
+
+	content, remain, diags := body.PartialContent(schema)
+	if diags.HasErrors() {
+		return nil, &ParseError{File: diagnosticsFile(diags), Diagnostics: diags}
+	}
+
+	layout := &jsonLayout{attributes: make(map[string]*hcl.Attribute)}
+	// anything else at the top level isn't compared
+	if kind != "" {
+		attrs, diags := remain.JustAttributes()
+		if diags.HasErrors() {
+			return nil, &ParseError{File: diagnosticsFile(diags), Diagnostics: diags}
+		}
+		var names []string
+		for name, _ := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			attr := attrs[name]
+			dec := json.NewDecoder(bytes.NewReader(attr.Expr.Range().SliceBytes(w.src)))
+			dec.UseNumber()
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				return nil, newParseError(attr.Expr.Range(), "Invalid JSON", err.Error())
+			}
+			// variable defaults and provider requirements are values, not
+			// templates
+			literal := kind == "variable" && name == "default" || kind == "required_providers"
+			fmt.Fprintf(&w.b, "%s%s = %s\n", indent, name, jsonValue(v, jsonExpressions[kind][name], literal))
+			layout.attributes[name] = attr
+		}
+	}
+
+	for _, block := range content.Blocks {
+		w.b.WriteString(indent + block.Type)
+		for _, label := range block.Labels {
+			fmt.Fprintf(&w.b, " %s", quoteJSONString(label, true))
+		}
+		w.b.WriteString(" {\n")
+		nested, err := w.body(block.Body, block.Type, indent+"  ")
+		if err != nil {
+			return nil, err
+		}
+		w.b.WriteString(indent + "}\n")
+		layout.blocks = append(layout.blocks, jsonBlock{block, nested})
+	}
+
+	return layout, nil
+}
+
+// relocate points the ranges of body, parsed from the native text of src
+// that jsonConfig wrote, into the JSON file: lines and columns become those
+// of the JSON source, so diagnostics and Resource.Line refer to it, while
+// byte offsets stay those of the native text, which sources are sliced
+// from.
+func (l *jsonLayout) relocate(body *hclsyntax.Body, src []byte) {
+	for name, attr := range body.Attributes {
+		j, ok := l.attributes[name]
+		if !ok {
+			continue
+		}
+		attr.NameRange = relocateRange(attr.NameRange, j.NameRange)
+		attr.EqualsRange = relocateRange(attr.EqualsRange, j.NameRange)
+		attr.SrcRange = relocateRange(attr.SrcRange, j.Range)
+
+		rng := attr.Expr.Range()
+		start := hcl.Pos{Line: j.Expr.Range().Start.Line, Column: j.Expr.Range().Start.Column, Byte: rng.Start.Byte}
+		if expr, diags := hclsyntax.ParseExpression(rng.SliceBytes(src), j.Expr.Range().Filename, start); !diags.HasErrors() {
+			attr.Expr = expr
+		}
+	}
+
+	for i, block := range body.Blocks {
+		if i >= len(l.blocks) {
+			break
+		}
+		j := l.blocks[i]
+		block.TypeRange = relocateRange(block.TypeRange, j.block.TypeRange)
+		for k := range block.LabelRanges {
+			if k < len(j.block.LabelRanges) {
+				block.LabelRanges[k] = relocateRange(block.LabelRanges[k], j.block.LabelRanges[k])
+			}
+		}
+		j.body.relocate(block.Body, src)
+	}
+}
+
+func relocateRange(native, source hcl.Range) hcl.Range {
+	return hcl.Range{
+		Filename: source.Filename,
+		Start:    hcl.Pos{Line: source.Start.Line, Column: source.Start.Column, Byte: native.Start.Byte},
+		End:      hcl.Pos{Line: source.End.Line, Column: source.End.Column, Byte: native.End.Byte},
+	}
+}
+
+func diagnosticsFile(diags hcl.Diagnostics) string {
+	for _, d := range diags {
+		if d.Subject != nil {
+			return d.Subject.Filename
+		}
+	}
+	return ""
+}
+
+func sortedTypes(types map[string]int) []string {
+	var names []string
+	for name, _ := range types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonValue formats v as an expression. Strings are templates, or the
+// expression they hold when expr is set, or taken literally when literal is.
+func jsonValue(v interface{}, expr, literal bool) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprint(v)
+	case json.Number:
+		return v.String()
+	case string:
+		if expr {
+			return strings.TrimSuffix(strings.TrimPrefix(v, "${"), "}")
+		}
+		return quoteJSONString(v, literal)
+	case []interface{}:
+		var elems []string
+		for _, e := range v {
+			elems = append(elems, jsonValue(e, expr, literal))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	case map[string]interface{}:
+		var attrs []string
+		for _, k := range sortedKeys(v) {
+			if k == "//" {
+				continue
+			}
+			attrs = append(attrs, fmt.Sprintf("%s = %s", quoteJSONString(k, true), jsonValue(v[k], expr, literal)))
+		}
+		return "{" + strings.Join(attrs, ", ") + "}"
+	}
+	return "null"
+}
+
+// quoteJSONString quotes s as a template, escaping its interpolation and
+// directive sequences too when it's literal.
+func quoteJSONString(s string, literal bool) string {
+	q, _ := json.Marshal(s)
+	t := string(q)
+	// json.Marshal escapes <, > and & for HTML; keep them readable
+	t = strings.NewReplacer(`\u003c`, "<", `\u003e`, ">", `\u0026`, "&").Replace(t)
+	if literal {
+		t = strings.NewReplacer("${", "$${", "%{", "%%{").Replace(t)
+	}
+	return t
+}
+
+func sortedKeys(obj map[string]interface{}) []string {
+	var keys []string
+	for k, _ := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
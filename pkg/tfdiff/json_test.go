@@ -0,0 +1,56 @@
+package tfdiff
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseJSON(t *testing.T) {
+	p := &Parser{}
+	resources, err := p.Parse([]File{{Name: "main.tf.json", Content: []byte(`{
+  "resource": {"aws_instance": {"web": {
+    "ami": "${var.ami}",
+    "instance_type": "t3.micro",
+    "tags": {"Name": "web"},
+    "depends_on": ["aws_vpc.main"]
+  }}},
+  "variable": {"ami": {"default": "${not a template}"}}
+}
+`)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := resources["aws_instance.web"]
+	if res == nil {
+		t.Fatalf("aws_instance.web isn't parsed: %v", resources)
+	}
+	if res.File != "main.tf.json" || res.Line != 2 {
+		t.Errorf("aws_instance.web is at %s:%d, want main.tf.json:2", res.File, res.Line)
+	}
+	if got := res.Attributes["instance_type"].AsString(); got != "t3.micro" {
+		t.Errorf("instance_type = %q, want t3.micro", got)
+	}
+	// the default is a value, evaluated into the template that refers to it
+	if got := res.Attributes["ami"].AsString(); got != "${not a template}" {
+		t.Errorf("ami = %q, want ${not a template}", got)
+	}
+}
+
+func TestParseJSONError(t *testing.T) {
+	p := &Parser{}
+	_, err := p.Parse([]File{{Name: "main.tf.json", Content: []byte("{\n  \"resource\": [\n")}})
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("err = %v, want a *ParseError", err)
+	}
+	if parseErr.File != "main.tf.json" {
+		t.Errorf("File = %q, want main.tf.json", parseErr.File)
+	}
+	for _, d := range parseErr.Diagnostics {
+		if d.Subject != nil && d.Subject.Start.Line > 1 {
+			return
+		}
+	}
+	t.Errorf("no diagnostic points past line 1: %v", parseErr.Diagnostics)
+}
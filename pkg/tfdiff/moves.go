@@ -0,0 +1,254 @@
+package tfdiff
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+type move struct {
+	from, to string
+}
+
+// decodeMove returns the addresses of a moved block.
+func decodeMove(block *hclsyntax.Block) (move, error) {
+	var m move
+	for _, name := range []string{"from", "to"} {
+		attr, ok := block.Body.Attributes[name]
+		if !ok {
+			return move{}, newParseError(block.DefRange(), "Missing required argument", fmt.Sprintf("moved block requires %s.", name))
+		}
+		t, diags := hcl.AbsTraversalForExpr(attr.Expr)
+		if diags.HasErrors() {
+			return move{}, newParseError(attr.Expr.Range(), "Invalid address", fmt.Sprintf("moved block %s isn't an address.", name))
+		}
+		if name == "from" {
+			m.from = traversalAddress(t)
+		} else {
+			m.to = traversalAddress(t)
+		}
+	}
+	return m, nil
+}
+
+// traversalAddress formats a traversal the way resource addresses are
+// written, such as module.a["key"].aws_instance.b.
+func traversalAddress(t hcl.Traversal) string {
+	var b strings.Builder
+	b.WriteString(t.RootName())
+	for _, step := range t[1:] {
+		switch s := step.(type) {
+		case hcl.TraverseAttr:
+			b.WriteString("." + s.Name)
+		case hcl.TraverseIndex:
+			if s.Key.Type() == cty.String {
+				fmt.Fprintf(&b, "[%q]", s.Key.AsString())
+			} else if s.Key.Type() == cty.Number {
+				fmt.Fprintf(&b, "[%s]", s.Key.AsBigFloat().Text('f', -1))
+			}
+		}
+	}
+	return b.String()
+}
+
+// applyMoves records on every resource the address a moved block relocates
+// it from. Moving a module moves everything in it.
+func applyMoves(resources map[string]*Resource, moves []move) {
+	for _, m := range moves {
+		for name, r := range resources {
+			if name == m.to || strings.HasPrefix(name, m.to+".") || strings.HasPrefix(name, m.to+"[") {
+				r.MovedFrom = append(r.MovedFrom, m.from+strings.TrimPrefix(name, m.to))
+			}
+		}
+	}
+}
+
+// pairMoves compares the resources moved by a moved block with what they
+// were moved from, instead of reporting one as removed and the other as
+// added. Terraform moves them in any plan, so only moves with content
+// changes are reported, as modified at their new address.
+func (d *Differ) pairMoves(result *DiffResult, baseResources, targetResources map[string]*Resource) {
+	removed := make(map[string]bool)
+	for _, name := range result.Removed {
+		removed[name] = true
+	}
+
+	var added []string
+	for _, name := range result.Added {
+		from := ""
+		for _, f := range targetResources[name].MovedFrom {
+			if removed[f] {
+				from = f
+				break
+			}
+		}
+		if from == "" {
+			added = append(added, name)
+			continue
+		}
+
+		delete(removed, from)
+		if !d.equalResources(baseResources[from], targetResources[name]) {
+			result.Modified = append(result.Modified, name)
+		}
+	}
+	result.Added = added
+
+	var kept []string
+	for _, name := range result.Removed {
+		if removed[name] {
+			kept = append(kept, name)
+		}
+	}
+	result.Removed = kept
+}
+
+// collapseMoves drops the relocations left after pairMoves from result:
+// resources removed and added with identical content under another name,
+// and module calls whose local source is the only change.
+func (d *Differ) collapseMoves(result *DiffResult, baseResources, targetResources map[string]*Resource) {
+	removed := make(map[string]bool)
+	for _, name := range result.Removed {
+		removed[name] = true
+	}
+	added := result.Added
+
+	// Without a moved block terraform replaces a renamed resource, so the
+	// pairing is only reported as a warning.
+	var remaining []string
+	for _, name := range added {
+		from := ""
+		for r, _ := range removed {
+			if ResourceType(r) == ResourceType(name) && d.equalResources(baseResources[r], targetResources[name]) {
+				if from != "" {
+					from = ""
+					break
+				}
+				from = r
+			}
+		}
+		if from == "" || !d.uniqueMatch(from, added, targetResources, baseResources) {
+			remaining = append(remaining, name)
+			continue
+		}
+
+		delete(removed, from)
+		verb := "renamed"
+		if localAddress(from) == localAddress(name) {
+			verb = "moved"
+		}
+		result.Warnings = append(result.Warnings, fmt.Sprintf("%s looks %s to %s without a moved block; terraform will replace it", from, verb, name))
+	}
+	result.Added = remaining
+
+	var kept []string
+	for _, name := range result.Removed {
+		if removed[name] {
+			kept = append(kept, name)
+		}
+	}
+	result.Removed = kept
+
+	var modified []string
+	for _, name := range result.Modified {
+		if isModuleCall(name) && d.onlySourceMoved(baseResources[name], targetResources[name]) {
+			continue
+		}
+		modified = append(modified, name)
+	}
+	result.Modified = modified
+}
+
+// warnScopeMoves warns about resources removed from one module and added
+// with the same type and name to another, or between the root module and a
+// module, which terraform replaces unless a moved block says otherwise. The
+// content often changes in such a refactor, as values become variables, so
+// it's only listed.
+func (d *Differ) warnScopeMoves(result *DiffResult, baseResources, targetResources map[string]*Resource) {
+	candidates := func(name string, addresses []string) []string {
+		var c []string
+		for _, a := range addresses {
+			if a != name && localAddress(a) == localAddress(name) {
+				c = append(c, a)
+			}
+		}
+		return c
+	}
+
+	for _, name := range result.Added {
+		if isModuleCall(name) {
+			continue
+		}
+		from := candidates(name, result.Removed)
+		if len(from) != 1 || len(candidates(from[0], result.Added)) != 1 {
+			continue
+		}
+		if containsAddress(targetResources[name].MovedFrom, from[0]) {
+			continue
+		}
+
+		msg := fmt.Sprintf("%s looks moved to %s without a moved block; terraform will replace it", from[0], name)
+		if changes := d.AttributeChanges(baseResources[from[0]], targetResources[name]); len(changes) > 0 {
+			msg += fmt.Sprintf(" (changed: %s)", strings.Join(changes, ", "))
+		}
+		result.Warnings = append(result.Warnings, msg)
+	}
+}
+
+// localAddress is address without the modules it is in.
+func localAddress(address string) string {
+	parts := SplitAddress(address)
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	return strings.Join(parts, ".")
+}
+
+func containsAddress(addresses []string, address string) bool {
+	for _, a := range addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueMatch tells whether from is identical to a single added resource, so
+// renames are only paired when there is no ambiguity.
+func (d *Differ) uniqueMatch(from string, added []string, targetResources, baseResources map[string]*Resource) bool {
+	n := 0
+	for _, name := range added {
+		if ResourceType(from) == ResourceType(name) && d.equalResources(baseResources[from], targetResources[name]) {
+			n++
+		}
+	}
+	return n == 1
+}
+
+// A module directory that moved only changes the source of its calls, and
+// its contents are compared resource by resource anyway.
+func (d *Differ) onlySourceMoved(base, target *Resource) bool {
+	changes := d.AttributeChanges(base, target)
+	if len(changes) != 1 || changes[0] != "source" {
+		return false
+	}
+	return isLocalSource(base.Attributes["source"]) && isLocalSource(target.Attributes["source"])
+}
+
+func isLocalSource(v cty.Value) bool {
+	if !v.IsKnown() || v.IsNull() || v.Type() != cty.String {
+		return false
+	}
+	return strings.HasPrefix(v.AsString(), "./") || strings.HasPrefix(v.AsString(), "../")
+}
+
+func isModuleCall(address string) bool {
+	parts := SplitAddress(address)
+	for len(parts) > 2 && parts[0] == "module" {
+		parts = parts[2:]
+	}
+	return len(parts) == 2 && parts[0] == "module"
+}
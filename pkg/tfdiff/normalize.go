@@ -0,0 +1,85 @@
+package tfdiff
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/zclconf/go-cty/cty"
+)
+
+// A Normalizer transforms a resource before it's compared, to leave out
+// differences that don't matter to the caller. It must not modify r, and
+// returns a copy instead if anything changes.
+type Normalizer func(r *Resource) *Resource
+
+var (
+	normalizersMu sync.Mutex
+	normalizers   = map[string]Normalizer{
+		"strip-tags":         StripAttributes("tags", "tags_all"),
+		"strip-descriptions": StripAttributes("description"),
+	}
+)
+
+// RegisterNormalizer makes n available under name, for programs that select
+// normalizers by name like the tfdiff command does with --normalize.
+func RegisterNormalizer(name string, n Normalizer) {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+	normalizers[name] = n
+}
+
+// LookupNormalizer returns the normalizer registered under name.
+func LookupNormalizer(name string) (Normalizer, bool) {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+	n, ok := normalizers[name]
+	return n, ok
+}
+
+// NormalizerNames returns the names of the registered normalizers, sorted.
+func NormalizerNames() []string {
+	normalizersMu.Lock()
+	defer normalizersMu.Unlock()
+	var names []string
+	for name, _ := range normalizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StripAttributes returns a normalizer dropping the top-level attributes
+// names.
+func StripAttributes(names ...string) Normalizer {
+	return func(r *Resource) *Resource {
+		found := false
+		for _, name := range names {
+			if _, ok := r.Attributes[name]; ok {
+				found = true
+			}
+		}
+		if !found {
+			return r
+		}
+
+		c := *r
+		c.Attributes = make(map[string]cty.Value)
+		for name, v := range r.Attributes {
+			c.Attributes[name] = v
+		}
+		for _, name := range names {
+			delete(c.Attributes, name)
+		}
+		return &c
+	}
+}
+
+func (d *Differ) normalize(r *Resource) *Resource {
+	if r == nil {
+		return nil
+	}
+	for _, n := range d.Normalizers {
+		r = n(r)
+	}
+	return r
+}
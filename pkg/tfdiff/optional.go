@@ -0,0 +1,109 @@
+package tfdiff
+
+import (
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// optionalAttrs records the optional(TYPE, DEFAULT) attributes of an object
+// type constraint, which this version of HCL can't parse, so that values
+// leaving them out get their defaults, or null, as in terraform. Elem
+// describes the elements of a collection of objects.
+type optionalAttrs struct {
+	Defaults map[string]cty.Value
+	Nested   map[string]*optionalAttrs
+	Elem     *optionalAttrs
+}
+
+// optionalType reads the optional attributes of a type constraint
+// expression, or returns nil if it has none.
+func optionalType(expr hcl.Expression) *optionalAttrs {
+	call, ok := expr.(*hclsyntax.FunctionCallExpr)
+	if !ok || len(call.Args) != 1 {
+		return nil
+	}
+
+	switch call.Name {
+	case "list", "set", "map":
+		if elem := optionalType(call.Args[0]); elem != nil {
+			return &optionalAttrs{Elem: elem}
+		}
+	case "object":
+		cons, ok := call.Args[0].(*hclsyntax.ObjectConsExpr)
+		if !ok {
+			return nil
+		}
+
+		o := &optionalAttrs{Defaults: make(map[string]cty.Value), Nested: make(map[string]*optionalAttrs)}
+		for _, item := range cons.Items {
+			name := hcl.ExprAsKeyword(item.KeyExpr)
+			if name == "" {
+				continue
+			}
+			typ := item.ValueExpr
+			if opt, ok := typ.(*hclsyntax.FunctionCallExpr); ok && opt.Name == "optional" && len(opt.Args) > 0 {
+				typ = opt.Args[0]
+				o.Defaults[name] = cty.NullVal(cty.DynamicPseudoType)
+				if len(opt.Args) > 1 {
+					if d, diags := opt.Args[1].Value(nil); !diags.HasErrors() {
+						o.Defaults[name] = d
+					}
+				}
+			}
+			if nested := optionalType(typ); nested != nil {
+				o.Nested[name] = nested
+			}
+		}
+		if len(o.Defaults) > 0 || len(o.Nested) > 0 {
+			return o
+		}
+	}
+	return nil
+}
+
+// apply fills in the optional attributes v leaves out.
+func (o *optionalAttrs) apply(v cty.Value) cty.Value {
+	if o == nil || !v.IsKnown() || v.IsNull() {
+		return v
+	}
+
+	t := v.Type()
+	switch {
+	case o.Elem != nil && (t.IsListType() || t.IsSetType() || t.IsTupleType()):
+		var elems []cty.Value
+		for _, e := range v.AsValueSlice() {
+			elems = append(elems, o.Elem.apply(e))
+		}
+		if len(elems) == 0 {
+			return v
+		}
+		return cty.TupleVal(elems)
+	case o.Elem != nil && (t.IsMapType() || t.IsObjectType()):
+		elems := make(map[string]cty.Value)
+		for k, e := range v.AsValueMap() {
+			elems[k] = o.Elem.apply(e)
+		}
+		if len(elems) == 0 {
+			return v
+		}
+		return cty.ObjectVal(elems)
+	case t.IsObjectType() || t.IsMapType():
+		attrs := v.AsValueMap()
+		if attrs == nil {
+			attrs = make(map[string]cty.Value)
+		}
+		for name, d := range o.Defaults {
+			if a, ok := attrs[name]; !ok || a.IsNull() {
+				attrs[name] = d
+			}
+		}
+		for name, nested := range o.Nested {
+			if a, ok := attrs[name]; ok {
+				attrs[name] = nested.apply(a)
+			}
+		}
+		return cty.ObjectVal(attrs)
+	}
+	return v
+}
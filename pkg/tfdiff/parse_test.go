@@ -0,0 +1,83 @@
+package tfdiff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// configTree makes n files of a few resources each, which refer to a
+// variable and to each other.
+func configTree(n int) []File {
+	files := []File{{Name: "variables.tf", Content: []byte(`variable "env" { default = "dev" }`)}}
+	for i := 0; i < n; i++ {
+		src := fmt.Sprintf(`
+resource "aws_instance" "web%[1]d" {
+  ami           = "ami-%[1]d"
+  instance_type = "t3.micro"
+  tags = {
+    Name = "web-${var.env}-%[1]d"
+  }
+}
+
+resource "aws_eip" "web%[1]d" {
+  instance = aws_instance.web%[1]d.id
+}
+`, i)
+		files = append(files, File{Name: fmt.Sprintf("web%d.tf", i), Content: []byte(src)})
+	}
+	return files
+}
+
+func TestParseConcurrency(t *testing.T) {
+	files := configTree(50)
+	serial, err := (&Parser{Concurrency: 1}).Parse(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(serial) != 100 {
+		t.Fatalf("parsed %d resources, want 100", len(serial))
+	}
+	for _, n := range []int{2, 8, 0} {
+		parallel, err := (&Parser{Concurrency: n}).Parse(files)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(serial, parallel) {
+			t.Errorf("Concurrency %d parses differently from 1", n)
+		}
+	}
+}
+
+func TestParseConcurrencyFirstError(t *testing.T) {
+	files := configTree(20)
+	files[5].Content = []byte(`resource "a_b" {`)
+	files[15].Content = []byte(`resource "a_b" {`)
+	for _, n := range []int{1, 4, 16} {
+		_, err := (&Parser{Concurrency: n}).Parse(files)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.File != files[5].Name {
+			t.Errorf("Concurrency %d: err = %v, want a ParseError for %s", n, err, files[5].Name)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	files := configTree(500)
+	workers := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		workers = append(workers, n)
+	}
+	for _, n := range workers {
+		b.Run(fmt.Sprintf("concurrency=%d", n), func(b *testing.B) {
+			p := &Parser{Concurrency: n}
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Parse(files); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
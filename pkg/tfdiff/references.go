@@ -0,0 +1,79 @@
+package tfdiff
+
+import (
+	"sort"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Reference roots that don't name a resource, data source or module call.
+var nonResourceRoots = map[string]bool{
+	"var":       true,
+	"local":     true,
+	"count":     true,
+	"each":      true,
+	"path":      true,
+	"terraform": true,
+	"self":      true,
+}
+
+// references returns the addresses a block body refers to, relative to its
+// module. Addresses that turn out not to exist, such as dynamic block
+// iterators, are left for the caller to ignore.
+func references(body *hclsyntax.Body) []string {
+	found := make(map[string]bool)
+	collectReferences(body, found)
+
+	var refs []string
+	for r, _ := range found {
+		refs = append(refs, r)
+	}
+	sort.Strings(refs)
+
+	return refs
+}
+
+func collectReferences(body *hclsyntax.Body, found map[string]bool) {
+	for name, attr := range body.Attributes {
+		// provider references name provider configurations
+		if name == "provider" || name == "providers" {
+			continue
+		}
+		for _, t := range attr.Expr.Variables() {
+			if r := referenceAddress(t); r != "" {
+				found[r] = true
+			}
+		}
+	}
+
+	for _, b := range body.Blocks {
+		collectReferences(b.Body, found)
+	}
+}
+
+func referenceAddress(t hcl.Traversal) string {
+	root := t.RootName()
+	if nonResourceRoots[root] {
+		return ""
+	}
+
+	var names []string
+	for _, step := range t[1:] {
+		a, ok := step.(hcl.TraverseAttr)
+		if !ok {
+			break
+		}
+		names = append(names, a.Name)
+	}
+
+	switch {
+	case root == "module" && len(names) >= 1:
+		return "module." + names[0]
+	case root == "data" && len(names) >= 2:
+		return "data." + names[0] + "." + names[1]
+	case root != "module" && root != "data" && len(names) >= 1:
+		return root + "." + names[0]
+	}
+	return ""
+}
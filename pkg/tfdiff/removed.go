@@ -0,0 +1,75 @@
+package tfdiff
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// RemovalsAddress is the address of the root module's removed blocks,
+// holding whether each from address is destroyed. Like the backend, it
+// isn't a resource.
+const RemovalsAddress = "terraform.removed"
+
+// decodeRemovals adds the removed blocks of body to the removals of
+// resources. Without lifecycle.destroy, terraform destroys the resource.
+func decodeRemovals(resources map[string]*Resource, body *hclsyntax.Body, name string) error {
+	for _, block := range body.Blocks {
+		if block.Type != "removed" {
+			continue
+		}
+
+		attr, ok := block.Body.Attributes["from"]
+		if !ok {
+			return newParseError(block.DefRange(), "Missing required argument", "removed block requires from.")
+		}
+		t, diags := hcl.AbsTraversalForExpr(attr.Expr)
+		if diags.HasErrors() {
+			return newParseError(attr.Expr.Range(), "Invalid address", "removed block from isn't an address.")
+		}
+
+		destroy := cty.True
+		for _, b := range block.Body.Blocks {
+			if attr, ok := b.Body.Attributes["destroy"]; ok && b.Type == "lifecycle" {
+				if v, diags := attr.Expr.Value(nil); !diags.HasErrors() && v.Type() == cty.Bool && v.IsKnown() && !v.IsNull() {
+					destroy = v
+				}
+			}
+		}
+
+		r, ok := resources[RemovalsAddress]
+		if !ok {
+			r = &Resource{Name: RemovalsAddress, File: name, Attributes: make(map[string]cty.Value)}
+			resources[r.Name] = r
+		}
+		r.Attributes[traversalAddress(t)] = destroy
+	}
+	return nil
+}
+
+// reconcileRemovals moves the removed resources covered by a removed block
+// of the target to DiffResult.RemovedByBlock.
+func reconcileRemovals(result *DiffResult, removals *Resource) {
+	if removals == nil {
+		return
+	}
+
+	var removed []string
+	for _, name := range result.Removed {
+		declared := false
+		for from, _ := range removals.Attributes {
+			if name == from || strings.HasPrefix(name, from+".") || strings.HasPrefix(name, from+"[") {
+				declared = true
+				break
+			}
+		}
+		if declared {
+			result.RemovedByBlock = append(result.RemovedByBlock, name)
+		} else {
+			removed = append(removed, name)
+		}
+	}
+	result.Removed = removed
+}
@@ -0,0 +1,736 @@
+package tfdiff
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Resource is a resource, data source, module call or output decoded from terraform configuration.
+type Resource struct {
+	Name       string
+	File       string
+	Line       int
+	Provider   string
+	Attributes map[string]cty.Value
+
+	// Blocks holds the nested blocks by type, in source order, since a
+	// type such as ingress may repeat.
+	Blocks map[string][]Block
+
+	// Sources holds the normalized source text of every attribute.
+	// Attributes that can't be evaluated statically are compared by it.
+	Sources map[string]string
+
+	// Source is the text of the block the resource was decoded from.
+	Source []byte
+
+	// References lists the addresses of the resources, data sources and
+	// module calls the block refers to, including through depends_on.
+	References []string
+
+	// MovedFrom lists the addresses moved blocks relocate to this one.
+	MovedFrom []string
+
+	// Ignored is set for blocks marked with a "# tfdiff:ignore" comment,
+	// on the line before the block or after its opening brace. Diff skips
+	// resources ignored on either side.
+	Ignored bool
+
+	inaccurate []string
+}
+
+// Inaccuracies lists the constructs of r that can't be evaluated
+// statically, when the parser tracked them.
+func (r *Resource) Inaccuracies() []string {
+	return r.inaccurate
+}
+
+// Block is a nested block of a Resource.
+type Block struct {
+	Attributes map[string]cty.Value
+	Blocks     map[string][]Block
+	Sources    map[string]string
+}
+
+// File is a configuration file to be parsed.
+type File struct {
+	Name    string
+	Content []byte
+}
+
+// Parser parses configuration files into resources.
+type Parser struct {
+	// Variables holds raw values for input variables, with the lowest
+	// precedence like TF_VAR_ environment variables.
+	Variables map[string]string
+
+	// Overrides holds raw values for input variables of the root module
+	// with the highest precedence, like terraform's -var.
+	Overrides map[string]string
+
+	// LoadModule returns the files of a local module directory, relative to
+	// the same root as the parsed file names. When set, resources of modules
+	// called with a local source are included under the module address.
+	LoadModule func(dir string) ([]File, error)
+
+	// FetchModule returns the files of a module with a non-local source
+	// such as the registry, or nil to skip it. Failures are reported as
+	// warnings and the module is compared by its arguments alone.
+	FetchModule func(source, version string) ([]File, error)
+
+	// WarnInaccurate adds a warning for every resource using constructs
+	// that can't be evaluated statically, such as dynamic blocks or
+	// references to other resources, whose diff may therefore be incomplete.
+	WarnInaccurate bool
+
+	// TrackInaccurate records the constructs WarnInaccurate warns about
+	// without warning, so the caller can summarize them through
+	// Resource.Inaccuracies.
+	TrackInaccurate bool
+
+	// Outputs includes output blocks, addressed as output.NAME. They can't
+	// be targeted but show interface changes of a module.
+	Outputs bool
+
+	// Scope, when set, limits the resources to those defined in the named
+	// files of the root module. Every file still contributes variable
+	// declarations.
+	Scope []string
+
+	// Concurrency bounds the number of files parsed at once. Zero means
+	// GOMAXPROCS.
+	Concurrency int
+
+	// SetBlocks lists, as TYPE.BLOCK, more block types that providers
+	// treat as sets, in addition to DefaultSetBlocks.
+	SetBlocks []string
+
+	// Warnings collects problems that didn't prevent parsing, such as
+	// variable values that don't match the declared type.
+	Warnings []string
+}
+
+// ParseResources parses files and returns their resources keyed by address.
+// Variable values are taken from TF_VAR_ environment variables.
+func ParseResources(files []File) (map[string]*Resource, error) {
+	p := &Parser{Variables: EnvVariables()}
+	return p.Parse(files)
+}
+
+// Parse parses files and returns their resources keyed by address. Files
+// ending in .tfvars supply variable values.
+func (p *Parser) Parse(files []File) (map[string]*Resource, error) {
+	resources, err := p.parseModule(files, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.WarnInaccurate {
+		var names []string
+		for name, r := range resources {
+			if len(r.inaccurate) > 0 {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			p.warn(fmt.Sprintf("%s may be diffed inaccurately: %s", name, strings.Join(resources[name].inaccurate, ", ")))
+		}
+	}
+
+	return resources, nil
+}
+
+// parseModule parses the files of a module, called by call, which is nil for
+// the root module.
+func (p *Parser) parseModule(files []File, call *Resource, stack []string) (map[string]*Resource, error) {
+	resources := make(map[string]*Resource)
+
+	var configs []File
+	var tfvars []File
+	layouts := make(map[int]*jsonLayout)
+
+	for _, f := range files {
+		// binary files that happen to match *.tf would only produce
+		// confusing diagnostics
+		if !isText(f.Content) {
+			p.warn(fmt.Sprintf("%s is skipped: it isn't a UTF-8 text file", f.Name))
+			continue
+		}
+		// git may check files out with CRLF line endings on one side only,
+		// which would show up in heredocs
+		f.Content = bytes.ReplaceAll(f.Content, []byte("\r\n"), []byte("\n"))
+
+		if strings.HasSuffix(f.Name, ".tfvars") || strings.HasSuffix(f.Name, ".tfvars.json") {
+			tfvars = append(tfvars, f)
+			continue
+		}
+		if strings.HasSuffix(f.Name, ".tf.json") {
+			content, layout, err := jsonConfig(f)
+			if err != nil {
+				return nil, err
+			}
+			f.Content = content
+			layouts[len(configs)] = layout
+		}
+		configs = append(configs, f)
+	}
+
+	bodies, err := p.parseFiles(configs)
+	if err != nil {
+		return nil, err
+	}
+	for i, layout := range layouts {
+		layout.relocate(bodies[i], configs[i].Content)
+	}
+
+	var inputs map[string]cty.Value
+	if call != nil {
+		// the call's arguments are compared as the module sees them
+		for name, decl := range declaredVariables(bodies) {
+			if v, ok := call.Attributes[name]; ok && decl.Optional != nil {
+				call.Attributes[name] = decl.Optional.apply(v)
+			}
+		}
+		inputs = moduleInputs(call)
+	}
+
+	var names []string
+	var sources [][]byte
+	for _, f := range configs {
+		names = append(names, f.Name)
+		sources = append(sources, f.Content)
+	}
+
+	var ctx *hcl.EvalContext
+	if inputs == nil {
+		ctx = p.evalContext(bodies, tfvars, p.Variables, nil)
+	} else {
+		// tfvars files and environment variables only apply to the root module
+		ctx = p.evalContext(bodies, nil, nil, inputs)
+	}
+
+	var moves []move
+	for i, body := range bodies {
+		if inputs == nil {
+			if backend := decodeBackend(body, sources[i], ctx); backend != nil {
+				backend.File = names[i]
+				resources[backend.Name] = backend
+			}
+			decodeRequiredProviders(resources, body, sources[i], ctx, names[i])
+			if err := decodeRemovals(resources, body, names[i]); err != nil {
+				return nil, err
+			}
+		}
+
+		if inputs == nil && !p.inScope(names[i]) {
+			continue
+		}
+
+		ignored := ignoredLines(sources[i], names[i])
+		for _, block := range body.Blocks {
+			if block.Type == "moved" {
+				m, err := decodeMove(block)
+				if err != nil {
+					return nil, err
+				}
+				moves = append(moves, m)
+				continue
+			}
+
+			if block.Type == "resource" || block.Type == "data" || block.Type == "module" || (block.Type == "output" && p.Outputs) {
+				decoded, err := decodeResource(block, sources[i], ctx, p.setBlocks(block))
+				if err != nil {
+					return nil, err
+				}
+				decoded.Ignored = ignored[block.TypeRange.Start.Line]
+
+				for _, resource := range moduleInstances(decoded, block, sources[i], ctx) {
+					resource.File = names[i]
+					// terraform rejects this within a directory, so the
+					// files given to Parse come from several
+					if other, ok := resources[resource.Name]; ok && other.File != resource.File {
+						p.warn(fmt.Sprintf("%s is defined in both %s and %s; the latter is compared", resource.Name, other.File, resource.File))
+					}
+					resources[resource.Name] = resource
+
+					if p.WarnInaccurate || p.TrackInaccurate {
+						resource.inaccurate = inaccuracies(block.Body, ctx)
+					}
+
+					if block.Type == "module" && (p.LoadModule != nil || p.FetchModule != nil) {
+						children, err := p.parseChild(resource, path.Dir(names[i]), stack)
+						if err != nil {
+							return nil, err
+						}
+						for _, c := range children {
+							c.Name = resource.Name + "." + c.Name
+							for j, r := range c.References {
+								c.References[j] = resource.Name + "." + r
+							}
+							for j, r := range c.MovedFrom {
+								c.MovedFrom[j] = resource.Name + "." + r
+							}
+							resources[c.Name] = c
+						}
+					}
+				}
+			}
+		}
+	}
+
+	applyMoves(resources, moves)
+	return resources, nil
+}
+
+// BackendAddress is the address of the root module's backend (or cloud)
+// configuration. It isn't a resource, and Diff reports changes to it as
+// DiffResult.BackendChanged.
+const BackendAddress = "terraform.backend"
+
+// decodeBackend returns the backend configuration of a terraform block in
+// body, if any, with the backend block keyed by its type.
+func decodeBackend(body *hclsyntax.Body, src []byte, ctx *hcl.EvalContext) *Resource {
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		for _, b := range block.Body.Blocks {
+			if b.Type == "backend" || b.Type == "cloud" {
+				return &Resource{Name: BackendAddress, Blocks: decodeBlocks(hclsyntax.Blocks{b}, src, ctx, nil, nil)}
+			}
+		}
+	}
+	return nil
+}
+
+// RequiredProvidersAddress is the address of the root module's provider
+// requirements, merged from every required_providers block. Like the
+// backend, it isn't a resource; Diff reports changes to it as
+// DiffResult.ProvidersChanged.
+const RequiredProvidersAddress = "terraform.required_providers"
+
+// IsSetting tells whether address is one of the terraform block settings
+// rather than a resource.
+func IsSetting(address string) bool {
+	return address == BackendAddress || address == RequiredProvidersAddress || address == RemovalsAddress
+}
+
+func decodeRequiredProviders(resources map[string]*Resource, body *hclsyntax.Body, src []byte, ctx *hcl.EvalContext, name string) {
+	for _, block := range body.Blocks {
+		if block.Type != "terraform" {
+			continue
+		}
+		for _, b := range block.Body.Blocks {
+			if b.Type != "required_providers" {
+				continue
+			}
+
+			r, ok := resources[RequiredProvidersAddress]
+			if !ok {
+				r = &Resource{Name: RequiredProvidersAddress, File: name, Attributes: make(map[string]cty.Value), Sources: make(map[string]string)}
+				resources[r.Name] = r
+			}
+			attrs, sources := decodeAttributes(b.Body.Attributes, src, ctx, nil)
+			for n, v := range attrs {
+				r.Attributes[n] = v
+				r.Sources[n] = sources[n]
+			}
+		}
+	}
+}
+
+func isText(content []byte) bool {
+	return utf8.Valid(content) && bytes.IndexByte(content, 0) < 0
+}
+
+func (p *Parser) inScope(name string) bool {
+	if p.Scope == nil {
+		return true
+	}
+	for _, s := range p.Scope {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFiles parses files on a bounded number of goroutines. Bodies are
+// returned in the order of files, and the error of the first file that
+// fails is reported, so the result doesn't depend on scheduling.
+func (p *Parser) parseFiles(files []File) ([]*hclsyntax.Body, error) {
+	bodies := make([]*hclsyntax.Body, len(files))
+	errs := make([]error, len(files))
+	calls := make([]bool, len(files))
+
+	workers := p.Concurrency
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				bodies[i], calls[i], errs[i] = parseFile(files[i])
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, f := range files {
+		if calls[i] {
+			p.warn(fmt.Sprintf("%s calls provider functions, which aren't evaluated; the attributes calling them are compared by their text", f.Name))
+		}
+	}
+
+	return bodies, nil
+}
+
+// hclparse.Parser caches files in a map and isn't safe for concurrent use,
+// so every file gets its own. It also tells whether the file calls provider
+// functions.
+func parseFile(f File) (*hclsyntax.Body, bool, error) {
+	content, calls := unnamespaceFunctions(f.Content)
+	hclFile, parseDiags := hclparse.NewParser().ParseHCL(content, f.Name)
+	if parseDiags.HasErrors() {
+		return nil, false, &ParseError{File: f.Name, Diagnostics: parseDiags}
+	}
+
+	body := reflect.ValueOf(hclFile.Body).Elem().Interface().(hclsyntax.Body)
+	return &body, calls, nil
+}
+
+// Module calls with a static count or for_each are split into their
+// instances, module.NAME[KEY], so each instance can be targeted and passes
+// its own each or count values to the module.
+func moduleInstances(module *Resource, block *hclsyntax.Block, src []byte, ctx *hcl.EvalContext) []*Resource {
+	if block.Type != "module" {
+		return []*Resource{module}
+	}
+
+	contexts := instances(block.Body.Attributes, ctx)
+	if contexts == nil {
+		return []*Resource{module}
+	}
+
+	_, counted := block.Body.Attributes["count"]
+	var modules []*Resource
+	for key, c := range contexts {
+		m := &Resource{Line: module.Line, Provider: module.Provider, Blocks: module.Blocks, Source: module.Source, References: module.References, Ignored: module.Ignored}
+		if counted {
+			m.Name = fmt.Sprintf("%s[%s]", module.Name, key)
+		} else {
+			m.Name = fmt.Sprintf("%s[%q]", module.Name, key)
+		}
+		m.Attributes, m.Sources = decodeAttributes(block.Body.Attributes, src, c, nil)
+		// an instance only changes with its own key and value, not when
+		// other instances are added or removed
+		for _, meta := range []string{"count", "for_each"} {
+			delete(m.Attributes, meta)
+			delete(m.Sources, meta)
+		}
+		modules = append(modules, m)
+	}
+
+	return modules
+}
+
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"providers":  true,
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+}
+
+// Local sources are read from the repository. Registry modules are only read
+// through FetchModule; otherwise they are compared by their arguments alone.
+func (p *Parser) parseChild(module *Resource, dir string, stack []string) (map[string]*Resource, error) {
+	source, ok := module.Attributes["source"]
+	if !ok || !source.IsKnown() || source.IsNull() || source.Type() != cty.String {
+		return nil, nil
+	}
+
+	s := source.AsString()
+	if !strings.HasPrefix(s, "./") && !strings.HasPrefix(s, "../") {
+		return p.parseRemoteChild(module, s, stack)
+	}
+	if p.LoadModule == nil {
+		return nil, nil
+	}
+
+	// Sources are relative to the directory of the calling file, and file
+	// names are relative to the root given to LoadModule, which modules
+	// can't be read from outside of.
+	moduleDir := path.Join(dir, s)
+	if moduleDir == ".." || strings.HasPrefix(moduleDir, "../") {
+		p.warn(fmt.Sprintf("%s: module %s has source %s outside the repository", module.File, module.Name, s))
+		return nil, nil
+	}
+	for _, d := range append(stack, dir) {
+		if d == moduleDir {
+			p.warn(fmt.Sprintf("%s: module %s calls itself recursively", module.File, module.Name))
+			return nil, nil
+		}
+	}
+
+	files, err := p.LoadModule(moduleDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parseModule(files, module, append(stack, dir))
+}
+
+func (p *Parser) parseRemoteChild(module *Resource, source string, stack []string) (map[string]*Resource, error) {
+	if p.FetchModule == nil {
+		return nil, nil
+	}
+
+	version := ""
+	if v, ok := module.Attributes["version"]; ok && v.IsKnown() && !v.IsNull() && v.Type() == cty.String {
+		version = v.AsString()
+	}
+
+	files, err := p.FetchModule(source, version)
+	if err != nil {
+		p.warn(fmt.Sprintf("%s: can't fetch module %s: %s", module.File, module.Name, err))
+		return nil, nil
+	}
+	if files == nil {
+		return nil, nil
+	}
+
+	return p.parseModule(files, module, stack)
+}
+
+func moduleInputs(module *Resource) map[string]cty.Value {
+	inputs := make(map[string]cty.Value)
+	for name, v := range module.Attributes {
+		if !moduleMetaArguments[name] {
+			inputs[name] = v
+		}
+	}
+	return inputs
+}
+
+var blockLabels = map[string][]string{
+	"resource": {"type", "name"},
+	"data":     {"type", "name"},
+	"module":   {"name"},
+	"output":   {"name"},
+}
+
+func decodeResource(block *hclsyntax.Block, src []byte, ctx *hcl.EvalContext, sets map[string]bool) (*Resource, error) {
+	if labels := blockLabels[block.Type]; len(block.Labels) != len(labels) {
+		return nil, newParseError(block.DefRange(), "Wrong number of labels", fmt.Sprintf("%s block requires %d label(s) (%s), got %d.",
+			block.Type, len(labels), strings.Join(labels, ", "), len(block.Labels)))
+	}
+
+	r := &Resource{Line: block.DefRange().Start.Line, Source: block.Range().SliceBytes(src), References: references(block.Body)}
+
+	if block.Type == "resource" {
+		r.Name = fmt.Sprintf("%s.%s", block.Labels[0], block.Labels[1])
+	} else if block.Type == "data" {
+		r.Name = fmt.Sprintf("data.%s.%s", block.Labels[0], block.Labels[1])
+	} else if block.Type == "module" {
+		r.Name = fmt.Sprintf("module.%s", block.Labels[0])
+	} else if block.Type == "output" {
+		// output values are mostly references to resources, so they are
+		// compared by their text
+		r.Name = fmt.Sprintf("output.%s", block.Labels[0])
+		if len(block.Body.Attributes) > 0 {
+			r.Attributes = decodeStaticAttributes(block.Body.Attributes, src, ctx)
+		}
+		return r, nil
+	}
+
+	// module instances are split up by moduleInstances
+	var contexts map[string]*hcl.EvalContext
+	if block.Type != "module" {
+		contexts = instances(block.Body.Attributes, ctx)
+	}
+
+	if len(block.Body.Attributes) > 0 {
+		r.Attributes, r.Sources = decodeAttributes(block.Body.Attributes, src, ctx, contexts)
+	}
+
+	if len(block.Body.Blocks) > 0 {
+		r.Blocks = decodeBlocks(block.Body.Blocks, src, ctx, contexts, sets)
+	}
+
+	// provider references can't be evaluated, so they are kept as text
+	// instead of collapsing into an unknown value that always compares equal.
+	if attr, ok := block.Body.Attributes["provider"]; ok {
+		r.Provider = providerRef(attr.Expr)
+	} else if attr, ok := block.Body.Attributes["providers"]; ok {
+		r.Provider = providerMap(attr.Expr)
+	}
+
+	return r, nil
+}
+
+func providerRef(expr hcl.Expression) string {
+	traversal, diags := hcl.AbsTraversalForExpr(expr)
+	if diags.HasErrors() {
+		return ""
+	}
+
+	parts := []string{traversal.RootName()}
+	for _, t := range traversal[1:] {
+		if a, ok := t.(hcl.TraverseAttr); ok {
+			parts = append(parts, a.Name)
+		}
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func providerMap(expr hcl.Expression) string {
+	pairs, diags := hcl.ExprMap(expr)
+	if diags.HasErrors() {
+		return ""
+	}
+
+	var providers []string
+	for _, pair := range pairs {
+		providers = append(providers, fmt.Sprintf("%s=%s", providerRef(pair.Key), providerRef(pair.Value)))
+	}
+	sort.Strings(providers)
+
+	return strings.Join(providers, ",")
+}
+
+// decodeAttributes evaluates attributes and also returns their normalized
+// source text, for the values that turn out unknown.
+func decodeAttributes(attributes hclsyntax.Attributes, src []byte, ctx *hcl.EvalContext, contexts map[string]*hcl.EvalContext) (map[string]cty.Value, map[string]string) {
+	a := make(map[string]cty.Value)
+	sources := make(map[string]string)
+
+	for _, attr := range attributes {
+		sources[attr.Name] = exprSource(attr.Expr, src)
+
+		if v, ok := instanceValue(attr.Expr, contexts); ok {
+			a[attr.Name] = v
+			continue
+		}
+
+		v, _ := attr.Expr.Value(ctx)
+		a[attr.Name] = unmark(v)
+	}
+
+	return a, sources
+}
+
+// Blocks of the types in sets are keyed by their content as well, see
+// setBlockKey.
+func decodeBlocks(blocks hclsyntax.Blocks, src []byte, ctx *hcl.EvalContext, contexts map[string]*hcl.EvalContext, sets map[string]bool) map[string][]Block {
+	block := make(map[string][]Block)
+
+	for _, b := range blocks {
+		if b.Type == "lifecycle" {
+			block[b.Type] = append(block[b.Type], decodeLifecycle(b, src, ctx))
+			continue
+		}
+
+		n := Block{}
+		if len(b.Body.Attributes) > 0 {
+			// when, on_failure and self references can't be evaluated,
+			// so provisioner scripts are compared by their text instead
+			if b.Type == "provisioner" || b.Type == "connection" {
+				n.Attributes = decodeStaticAttributes(b.Body.Attributes, src, ctx)
+			} else {
+				n.Attributes, n.Sources = decodeAttributes(b.Body.Attributes, src, ctx, contexts)
+			}
+		}
+
+		if len(b.Body.Blocks) > 0 {
+			n.Blocks = decodeBlocks(b.Body.Blocks, src, ctx, contexts, nil)
+		}
+
+		key := blockKey(b)
+		if sets[b.Type] {
+			key = setBlockKey(b.Type, n)
+		}
+		block[key] = append(block[key], n)
+	}
+
+	return block
+}
+
+// Labeled blocks such as provisioner "local-exec" and dynamic "ingress" are
+// keyed by their labels too, so blocks of different kinds don't collide.
+func blockKey(b *hclsyntax.Block) string {
+	return strings.Join(append([]string{b.Type}, b.Labels...), ".")
+}
+
+// Lifecycle arguments (ignore_changes, replace_triggered_by, conditions) are
+// mostly references that can't be evaluated statically, so those are compared
+// by their source text.
+func decodeLifecycle(block *hclsyntax.Block, src []byte, ctx *hcl.EvalContext) Block {
+	n := Block{}
+	if len(block.Body.Attributes) > 0 {
+		n.Attributes = decodeStaticAttributes(block.Body.Attributes, src, ctx)
+	}
+
+	for _, b := range block.Body.Blocks {
+		if n.Blocks == nil {
+			n.Blocks = make(map[string][]Block)
+		}
+
+		c := Block{}
+		if len(b.Body.Attributes) > 0 {
+			c.Attributes = decodeStaticAttributes(b.Body.Attributes, src, ctx)
+		}
+
+		n.Blocks[b.Type] = append(n.Blocks[b.Type], c)
+	}
+
+	return n
+}
+
+func decodeStaticAttributes(attributes hclsyntax.Attributes, src []byte, ctx *hcl.EvalContext) map[string]cty.Value {
+	a, _ := decodeAttributes(attributes, src, ctx, nil)
+
+	for _, attr := range attributes {
+		if !a[attr.Name].IsWhollyKnown() {
+			a[attr.Name] = cty.StringVal(exprSource(attr.Expr, src))
+		}
+	}
+
+	return a
+}
+
+func exprSource(expr hcl.Expression, src []byte) string {
+	return strings.TrimSpace(string(hclwrite.Format(expr.Range().SliceBytes(src))))
+}
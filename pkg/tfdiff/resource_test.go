@@ -0,0 +1,92 @@
+package tfdiff
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseWrongLabels(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"\nresource \"aws_instance\" {}", "resource block requires 2 label(s) (type, name), got 1."},
+		{"\nresource \"aws_instance\" \"a\" \"b\" {}", "resource block requires 2 label(s) (type, name), got 3."},
+		{"\ndata \"aws_ami\" {}", "data block requires 2 label(s) (type, name), got 1."},
+		{"\nmodule \"a\" \"b\" {}", "module block requires 1 label(s) (name), got 2."},
+	}
+	for _, tt := range tests {
+		p := &Parser{}
+		_, err := p.Parse([]File{{Name: "main.tf", Content: []byte(tt.src)}})
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Errorf("Parse(%q) = %v, want a *ParseError", tt.src, err)
+			continue
+		}
+		// the diagnostic points at the block
+		d := parseErr.Diagnostics[0]
+		if d.Summary != "Wrong number of labels" || d.Detail != tt.want || d.Subject == nil || d.Subject.Start.Line != 2 {
+			t.Errorf("Parse(%q): %s: %s at %v, want %s at line 2", tt.src, d.Summary, d.Detail, d.Subject, tt.want)
+		}
+	}
+}
+
+func TestParseValidLabels(t *testing.T) {
+	resources := parseResources(t, `
+resource "aws_instance" "a" {}
+data "aws_ami" "a" {}
+module "a" {
+  source = "./a"
+}
+`)
+	for _, address := range []string{"aws_instance.a", "data.aws_ami.a", "module.a"} {
+		if resources[address] == nil {
+			t.Errorf("%s is missing: %v", address, resources)
+		}
+	}
+}
+
+func TestDecodeBlocksKeys(t *testing.T) {
+	resources := parseResources(t, `
+resource "null_resource" "a" {
+  provisioner "local-exec" {
+    command = "a"
+  }
+  provisioner "local-exec" {
+    command = "b"
+  }
+  provisioner "remote-exec" {
+    inline = ["c"]
+  }
+  dynamic "ingress" {
+    for_each = []
+    content {}
+  }
+  rule {}
+  rule {}
+  rule {}
+}
+`)
+	r := resources["null_resource.a"]
+	if r == nil {
+		t.Fatalf("null_resource.a is missing: %v", resources)
+	}
+	want := map[string]int{
+		"provisioner.local-exec":  2,
+		"provisioner.remote-exec": 1,
+		"dynamic.ingress":         1,
+		"rule":                    3,
+	}
+	got := make(map[string]int)
+	for key, blocks := range r.Blocks {
+		got[key] = len(blocks)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("blocks = %v, want %v", got, want)
+	}
+	// repeated blocks keep their source order
+	if c := r.Blocks["provisioner.local-exec"][1].Attributes["command"]; c.AsString() != "b" {
+		t.Errorf("second local-exec command = %#v, want b", c)
+	}
+}
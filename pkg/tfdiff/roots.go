@@ -0,0 +1,59 @@
+package tfdiff
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	hcljson "github.com/hashicorp/hcl/v2/json"
+)
+
+var (
+	moduleCallSchema   = &hcl.BodySchema{Blocks: []hcl.BlockHeaderSchema{{Type: "module", LabelNames: []string{"name"}}}}
+	moduleSourceSchema = &hcl.BodySchema{Attributes: []hcl.AttributeSchema{{Name: "source"}}}
+)
+
+// ModuleSources returns the directories of the local modules called by the
+// module blocks of files, relative to the same root as the file names.
+// Files that don't parse are skipped; Parse reports them.
+func ModuleSources(files []File) []string {
+	found := make(map[string]bool)
+	for _, f := range files {
+		var file *hcl.File
+		var diags hcl.Diagnostics
+		switch {
+		case strings.HasSuffix(f.Name, ".tf"):
+			file, diags = hclsyntax.ParseConfig(f.Content, f.Name, hcl.Pos{Line: 1, Column: 1})
+		case strings.HasSuffix(f.Name, ".tf.json"):
+			file, diags = hcljson.Parse(f.Content, f.Name)
+		default:
+			continue
+		}
+		if diags.HasErrors() {
+			continue
+		}
+
+		content, _, _ := file.Body.PartialContent(moduleCallSchema)
+		for _, block := range content.Blocks {
+			attrs, _, _ := block.Body.PartialContent(moduleSourceSchema)
+			attr, ok := attrs.Attributes["source"]
+			if !ok {
+				continue
+			}
+			v, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() || !isLocalSource(v) {
+				continue
+			}
+			found[path.Join(path.Dir(f.Name), v.AsString())] = true
+		}
+	}
+
+	var dirs []string
+	for dir, _ := range found {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
@@ -0,0 +1,32 @@
+package tfdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestModuleSources(t *testing.T) {
+	files := []File{
+		{Name: "infra/main.tf", Content: []byte(`
+module "vpc" {
+  source = "./modules/vpc"
+}
+module "registry" {
+  source  = "terraform-aws-modules/vpc/aws"
+  version = "3.0.0"
+}
+`)},
+		{Name: "infra/modules/vpc/main.tf", Content: []byte(`
+module "subnets" {
+  source = "../subnets"
+}
+`)},
+		{Name: "infra/shared.tf.json", Content: []byte(`{"module": {"dns": {"source": "./modules/dns"}}}`)},
+		{Name: "infra/broken.tf", Content: []byte(`module "x" {`)},
+	}
+
+	want := []string{"infra/modules/dns", "infra/modules/subnets", "infra/modules/vpc"}
+	if got := ModuleSources(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("ModuleSources() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,86 @@
+package tfdiff
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// DefaultSetBlocks lists, as TYPE.BLOCK, nested block types that providers
+// treat as sets, so their order in the configuration doesn't matter.
+var DefaultSetBlocks = []string{
+	"aws_autoscaling_group.tag",
+	"aws_instance.ebs_block_device",
+	"aws_instance.ephemeral_block_device",
+	"aws_lb_listener_rule.condition",
+	"aws_network_acl.egress",
+	"aws_network_acl.ingress",
+	"aws_security_group.egress",
+	"aws_security_group.ingress",
+	"google_compute_firewall.allow",
+	"google_compute_firewall.deny",
+}
+
+// setBlocks returns the set block types of a resource block.
+func (p *Parser) setBlocks(block *hclsyntax.Block) map[string]bool {
+	// decodeResource reports the missing labels
+	if block.Type != "resource" && block.Type != "data" || len(block.Labels) < 2 {
+		return nil
+	}
+
+	sets := make(map[string]bool)
+	for _, list := range [][]string{DefaultSetBlocks, p.SetBlocks} {
+		for _, s := range list {
+			if strings.HasPrefix(s, block.Labels[0]+".") {
+				sets[strings.TrimPrefix(s, block.Labels[0]+".")] = true
+			}
+		}
+	}
+	return sets
+}
+
+// setBlockKey keys a block of a set type by its content, such as
+// ingress{from_port=80, to_port=80}, so the blocks are matched by content
+// rather than order. Changing such a block shows as one block removed and
+// another added.
+func setBlockKey(typ string, b Block) string {
+	return typ + "{" + inlineBlock(b) + "}"
+}
+
+// inlineBlock renders b on one line with sorted attributes and blocks.
+// Values that can't be evaluated statically are rendered by their source
+// text.
+func inlineBlock(b Block) string {
+	var parts []string
+
+	var names []string
+	for name, _ := range b.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := b.Attributes[name]
+		text := strings.Join(strings.Fields(b.Sources[name]), " ")
+		if v.IsWhollyKnown() {
+			if j, err := ctyjson.Marshal(v, v.Type()); err == nil {
+				text = string(j)
+			}
+		}
+		parts = append(parts, name+"="+text)
+	}
+
+	var keys []string
+	for key, _ := range b.Blocks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, nested := range b.Blocks[key] {
+			parts = append(parts, key+"{"+inlineBlock(nested)+"}")
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
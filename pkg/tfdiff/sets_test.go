@@ -0,0 +1,85 @@
+package tfdiff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func parseResources(t *testing.T, src string) map[string]*Resource {
+	t.Helper()
+	p := &Parser{}
+	resources, err := p.Parse([]File{{Name: "main.tf", Content: []byte(src)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resources
+}
+
+func TestSetBlocksOrder(t *testing.T) {
+	base := parseResources(t, `
+resource "aws_security_group" "s" {
+  ingress {
+    from_port = 80
+  }
+  ingress {
+    from_port = 443
+  }
+}
+`)
+	target := parseResources(t, `
+resource "aws_security_group" "s" {
+  ingress {
+    from_port = 443
+  }
+  ingress {
+    from_port = 80
+  }
+}
+`)
+	d := &Differ{}
+	if changes := d.AttributeChanges(base["aws_security_group.s"], target["aws_security_group.s"]); len(changes) > 0 {
+		t.Errorf("reordered set blocks differ: %v", changes)
+	}
+}
+
+func TestSetBlockKeys(t *testing.T) {
+	base := parseResources(t, `
+resource "aws_security_group" "s" {
+  ingress {
+    from_port   = 80
+    cidr_blocks = ["10.0.0.0/16"]
+  }
+}
+`)
+	target := parseResources(t, `
+resource "aws_security_group" "s" {
+  ingress {
+    from_port   = 8080
+    cidr_blocks = ["10.0.0.0/16"]
+  }
+}
+`)
+	d := &Differ{}
+	got := d.AttributeChanges(base["aws_security_group.s"], target["aws_security_group.s"])
+	want := []string{
+		`ingress{cidr_blocks=["10.0.0.0/16"], from_port=8080}`,
+		`ingress{cidr_blocks=["10.0.0.0/16"], from_port=80}`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("AttributeChanges() = %q, want %q", got, want)
+	}
+}
+
+func TestParseMissingLabels(t *testing.T) {
+	for _, src := range []string{
+		`resource {}`,
+		`resource "aws_security_group" {}`,
+		`data {}`,
+		`module {}`,
+	} {
+		p := &Parser{}
+		if _, err := p.Parse([]File{{Name: "main.tf", Content: []byte(src)}}); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", src)
+		}
+	}
+}
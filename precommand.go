@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	pathpkg "path"
+	"path/filepath"
+
+	"github.com/go-git/go-billy/v5"
+	"github.com/go-git/go-billy/v5/osfs"
+	"github.com/go-git/go-billy/v5/util"
+)
+
+var tempDirs []string
+
+func removeTempDirs() {
+	for _, d := range tempDirs {
+		os.RemoveAll(d)
+	}
+	tempDirs = nil
+}
+
+// generateCopy copies fs to a temporary directory and runs --pre-command in
+// its directory path, so generated files can be compared without touching
+// the repository or a worktree.
+func generateCopy(opts *options, fs billy.Filesystem, path string) (billy.Filesystem, error) {
+	dir, err := ioutil.TempDir("", "tfdiff-")
+	if err != nil {
+		return nil, err
+	}
+	tempDirs = append(tempDirs, dir)
+
+	if err := copyTree(fs, "", dir); err != nil {
+		return nil, err
+	}
+
+	// the directory may not exist yet at the base
+	generated := filepath.Join(dir, filepath.FromSlash(path))
+	if _, err := os.Stat(generated); err == nil {
+		if err := runPreCommand(opts, generated); err != nil {
+			return nil, err
+		}
+	}
+
+	return osfs.New(dir), nil
+}
+
+// runPreCommand runs --pre-command in dir. Its output goes to stderr so it
+// doesn't mix with the targets.
+func runPreCommand(opts *options, dir string) error {
+	cmd := exec.Command("sh", "-c", opts.preCommand)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pre-command failed in %s: %s", dir, err)
+	}
+	return nil
+}
+
+func copyTree(fs billy.Filesystem, src, dst string) error {
+	dir := src
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		s := pathpkg.Join(src, e.Name())
+		d := filepath.Join(dst, e.Name())
+
+		if e.Name() == ".git" {
+			continue
+		}
+
+		switch {
+		case e.IsDir():
+			if err := os.MkdirAll(d, 0755); err != nil {
+				return err
+			}
+			if err := copyTree(fs, s, d); err != nil {
+				return err
+			}
+		case e.Mode()&os.ModeSymlink != 0:
+			target, err := fs.Readlink(s)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(target, d); err != nil {
+				return err
+			}
+		default:
+			c, err := util.ReadFile(fs, s)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(d, c, e.Mode().Perm()); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
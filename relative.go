@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// relativeModule returns the address of the module call whose source is the
+// --relative-to directory, so targets can be rewritten for a terraform
+// invocation there. The module calls of either side are searched, since
+// removed resources may only be known to the base.
+func relativeModule(opts *options, dir string, resources ...map[string]*tfdiff.Resource) (string, error) {
+	target, err := repoRelative(opts, dir)
+	if err != nil {
+		return "", err
+	}
+
+	for _, r := range resources {
+		var calls []string
+		for name, resource := range r {
+			if !isModuleCall(name) {
+				continue
+			}
+			source, ok := resource.Attributes["source"]
+			if !ok || source.IsNull() || !source.IsKnown() || source.Type() != cty.String {
+				continue
+			}
+			if !strings.HasPrefix(source.AsString(), "./") && !strings.HasPrefix(source.AsString(), "../") {
+				continue
+			}
+			if pathpkg.Join(pathpkg.Dir(resource.File), source.AsString()) == target {
+				calls = append(calls, name)
+			}
+		}
+
+		switch len(calls) {
+		case 0:
+			continue
+		case 1:
+			return calls[0], nil
+		default:
+			sort.Strings(calls)
+			return "", fmt.Errorf("--relative-to %s: the module is called more than once (%s)", dir, strings.Join(calls, ", "))
+		}
+	}
+
+	return "", fmt.Errorf("--relative-to %s: no module call has it as its source", dir)
+}
+
+// repoRelative returns dir, relative to --chdir if given, relative to the
+// repository root, the root of the resource file names.
+func repoRelative(opts *options, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workDir(opts), dir)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	root, err := filepath.Abs(workDir(opts))
+	if err != nil {
+		return "", err
+	}
+	if r, err := gitCommand(opts, "rev-parse", "--show-toplevel").Output(); err == nil {
+		root = strings.TrimSpace(string(r))
+	}
+
+	rel, err := filepath.Rel(root, abs)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// isModuleCall tells whether address is a module call, rather than something
+// inside a module.
+func isModuleCall(address string) bool {
+	parts := localAddress(address)
+	return len(parts) == 2 && parts[0] == "module"
+}
+
+// relativeTargets strips the module prefix from targets inside module and
+// drops the others, which can't be targeted from the module's directory.
+func relativeTargets(module string, targets []string) []string {
+	var relative []string
+	dropped := 0
+	for _, t := range targets {
+		if !strings.HasPrefix(t, module+".") {
+			dropped++
+			continue
+		}
+		relative = append(relative, strings.TrimPrefix(t, module+"."))
+	}
+
+	if dropped > 0 {
+		warn(fmt.Sprintf("%d targets outside %s are dropped", dropped, module))
+	}
+	return relative
+}
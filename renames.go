@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+type rename struct {
+	from, to string
+}
+
+// readRenames reads a renames file: a line per rename, the old address and
+// the new one separated by whitespace. Blank lines and lines starting with #
+// are skipped.
+func readRenames(filename string) ([]rename, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var renames []rename
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected an old and a new address", filename, i+1)
+		}
+		renames = append(renames, rename{fields[0], fields[1]})
+	}
+	return renames, nil
+}
+
+// applyRenames moves the base resources to their new addresses, so they are
+// compared with the target resources there. Renaming a module renames
+// everything in it.
+func applyRenames(resources map[string]*tfdiff.Resource, renames []rename) {
+	for _, rn := range renames {
+		var names []string
+		for name, _ := range resources {
+			if name == rn.from || strings.HasPrefix(name, rn.from+".") || strings.HasPrefix(name, rn.from+"[") {
+				names = append(names, name)
+			}
+		}
+
+		for _, name := range names {
+			r := resources[name]
+			to := rn.to + strings.TrimPrefix(name, rn.from)
+			if _, ok := resources[to]; ok {
+				warn(fmt.Sprintf("%s isn't renamed to %s, which already exists", name, to))
+				continue
+			}
+			delete(resources, name)
+			r.Name = to
+			resources[to] = r
+		}
+	}
+}
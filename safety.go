@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// checkTargeting decides whether the targets cover the change, setting
+// opts.fullPlan when they don't.
+//
+// After a backend change, targets would refer to a different state, after a
+// provider change any resource may plan differently, and past --max-targets
+// a full plan is usually cheaper and the command line may not even fit, so
+// these always fall back to a full plan. Resources compared equal despite
+// values that can't be evaluated statically may still change without being
+// targeted when those values come from a differing resource; that only
+// falls back with --auto-full and is recommended otherwise.
+func checkTargeting(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) {
+	var reasons []string
+	if result.BackendChanged {
+		reasons = append(reasons, "the backend configuration changes")
+	}
+	if result.ProvidersChanged {
+		reasons = append(reasons, "the provider requirements change")
+	}
+	if t := targets(opts, result); opts.maxTargets > 0 && len(t) > opts.maxTargets {
+		reasons = append(reasons, fmt.Sprintf("%d resources differ, more than --max-targets %d", len(t), opts.maxTargets))
+	}
+	required := len(reasons) > 0
+
+	// with --assume-changed-on-unknown these are already targeted, and
+	// state has no unevaluated values
+	if !opts.assumeChanged && opts.stateJSON == "" {
+		if unknown := unresolved(opts, result, baseResources, targetResources); len(unknown) > 0 {
+			names := unknown
+			if len(names) > 3 {
+				names = append(names[:3:3], "...")
+			}
+			reasons = append(reasons, fmt.Sprintf("%d untargeted resources have values that can't be evaluated statically (%s)", len(unknown), strings.Join(names, ", ")))
+		}
+	}
+
+	if len(reasons) == 0 || len(result.Targets()) == 0 && !required {
+		return
+	}
+	if required || opts.autoFull {
+		opts.fullPlan = true
+		warn("falling back to a full plan: " + strings.Join(reasons, "; "))
+	} else {
+		warn("targeting may miss changes: " + strings.Join(reasons, "; ") + "; a full plan is recommended (--auto-full falls back to one)")
+	}
+}
+
+// unresolved returns the resources on both sides that compared equal but
+// have unknown values and refer to a differing resource, which may hide a
+// change. Unknown values read from unchanged resources stay the same.
+func unresolved(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) []string {
+	differing := append(append(append([]string{}, result.Added...), result.Modified...), result.Removed...)
+
+	var unknown []string
+	for address, target := range targetResources {
+		base, ok := baseResources[address]
+		if !ok || tfdiff.IsSetting(address) || !isTarget(opts, address) || containsString(result.Modified, address) {
+			continue
+		}
+		if !tfdiff.HasUnknown(base) && !tfdiff.HasUnknown(target) {
+			continue
+		}
+		if refersToAny(targetReferences(address, baseResources, targetResources), differing) {
+			unknown = append(unknown, address)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// untargetable lists the changes that -target and -replace can't express,
+// since terraform only applies them in a full plan.
+func untargetable(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) []string {
+	var reasons []string
+	if result.BackendChanged {
+		reasons = append(reasons, "the backend configuration changes, which moves the state")
+	}
+	if result.ProvidersChanged {
+		reasons = append(reasons, "the provider requirements change, which can affect every resource of those providers")
+	}
+
+	for _, address := range result.Targets() {
+		if isOutput(address) {
+			reasons = append(reasons, fmt.Sprintf("%s changes, and outputs can't be targeted", address))
+		}
+	}
+	for _, address := range append(append([]string{}, result.Added...), result.Modified...) {
+		target := targetResources[address]
+		if target == nil {
+			continue
+		}
+		for _, from := range target.MovedFrom {
+			if _, ok := baseResources[from]; ok {
+				reasons = append(reasons, fmt.Sprintf("%s is moved from %s by a moved block", address, from))
+				break
+			}
+		}
+	}
+	for _, address := range result.RemovedByBlock {
+		reasons = append(reasons, fmt.Sprintf("%s is removed by a removed block", address))
+	}
+
+	sort.Strings(reasons)
+	return reasons
+}
+
+// checkTargetable fails with the changes -target can't express, if any.
+func checkTargetable(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	reasons := untargetable(opts, result, baseResources, targetResources)
+	if len(reasons) > 0 {
+		return fmt.Errorf("a targeted apply can't express every change:\n  %s", strings.Join(reasons, "\n  "))
+	}
+
+	fmt.Fprintf(w, "every change can be targeted (%d targets)\n", len(targets(opts, result)))
+	return nil
+}
+
+func refersToAny(refs, addresses []string) bool {
+	for _, ref := range refs {
+		for _, address := range addresses {
+			if refersTo(ref, address) || refersTo(address, ref) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+func parseConfig(t *testing.T, src string) map[string]*tfdiff.Resource {
+	t.Helper()
+	p := &tfdiff.Parser{}
+	resources, err := p.Parse([]tfdiff.File{{Name: "main.tf", Content: []byte(src)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resources
+}
+
+func TestUnresolved(t *testing.T) {
+	base := parseConfig(t, `
+resource "x_a" "a" { n = 1 }
+resource "x_b" "b" { v = x_a.a.id }
+resource "x_c" "c" { v = x_b.b.id }
+resource "x_d" "d" { v = x_e.e.id }
+resource "x_e" "e" { n = 1 }
+`)
+	target := parseConfig(t, `
+resource "x_a" "a" { n = 2 }
+resource "x_b" "b" { v = x_a.a.id }
+resource "x_c" "c" { v = x_b.b.id }
+resource "x_d" "d" { v = x_e.e.id }
+resource "x_e" "e" { n = 1 }
+`)
+	opts := &options{}
+	result := newDiffer(opts).Diff(base, target)
+
+	// x_c and x_d read unknown values from unchanged resources
+	got := unresolved(opts, result, base, target)
+	if want := []string{"x_b.b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unresolved() = %v, want %v", got, want)
+	}
+}
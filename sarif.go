@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// The subset of SARIF 2.1.0 code-scanning dashboards need to show a result
+// at a location.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// writeSARIF reports every differing resource as a note at the block that
+// defines it. Removed resources point at their definition on the base side.
+func writeSARIF(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	differ := newDiffer(opts)
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "tfdiff",
+			InformationURI: "https://github.com/mizzy/tfdiff",
+			Rules: []sarifRule{
+				{ID: "added", ShortDescription: sarifMessage{Text: "Resource added"}},
+				{ID: "modified", ShortDescription: sarifMessage{Text: "Resource modified"}},
+				{ID: "removed", ShortDescription: sarifMessage{Text: "Resource removed"}},
+			},
+		}},
+		Results: []sarifResult{},
+	}
+
+	results := func(addresses []string, change string, resources map[string]*tfdiff.Resource) {
+		for _, address := range addresses {
+			text := fmt.Sprintf("%s is %s", address, change)
+			if change == "modified" {
+				text += ": " + strings.Join(differ.AttributeChanges(baseResources[address], targetResources[address]), ", ")
+			}
+
+			r := sarifResult{RuleID: change, Level: "note", Message: sarifMessage{Text: text}}
+			if res := resources[address]; res.File != "" {
+				loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: res.File}}
+				if res.Line > 0 {
+					loc.Region = &sarifRegion{StartLine: res.Line}
+				}
+				r.Locations = []sarifLocation{{PhysicalLocation: loc}}
+			}
+			run.Results = append(run.Results, r)
+		}
+	}
+	results(result.Added, "added", targetResources)
+	results(result.Modified, "modified", targetResources)
+	results(result.Removed, "removed", baseResources)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	pathpkg "path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// smartFilter keeps the differing resources defined in files changed
+// since the base, and those referring to them, directly or through the
+// module calls they are nested in. Changed module calls keep everything in
+// them, and when a changed file declares variables or locals, or is a
+// tfvars file, the resources using var or local values are kept too, as
+// are those using path values, which read files, when a file other than a
+// configuration file changed.
+//
+// All resources are still parsed and compared, so this only narrows the
+// report; --full turns it off. It needs a base ref in the repository, so the
+// other bases always report in full.
+func smartFilter(opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) (tfdiff.DiffResult, error) {
+	if opts.full || opts.noGit || opts.baseline != "" || opts.stateJSON != "" || opts.baseWorktree != "" || opts.baseRepo != "" || opts.baseArchive != "" {
+		return result, nil
+	}
+
+	base, err := baseRef(opts)
+	if err != nil {
+		return result, err
+	}
+
+	changed, err := changedFiles(opts, base)
+	if err != nil {
+		return result, err
+	}
+	inputs := changedInputs(opts, base, changed)
+
+	kept := make(map[string]bool)
+	differing := result.Targets()
+	for _, address := range differing {
+		for _, resources := range []map[string]*tfdiff.Resource{baseResources, targetResources} {
+			if r, ok := resources[address]; ok && (changed[r.File] || usesInputs(r, inputs)) {
+				kept[address] = true
+			}
+		}
+	}
+
+	// follow references and module calls until nothing more is kept
+	for grown := true; grown; {
+		grown = false
+		for _, address := range differing {
+			if kept[address] {
+				continue
+			}
+			for k, _ := range kept {
+				if isModuleCall(k) && refersTo(k, address) {
+					kept[address] = true
+					break
+				}
+			}
+			for _, ref := range targetReferences(address, baseResources, targetResources) {
+				if kept[address] {
+					break
+				}
+				for k, _ := range kept {
+					if refersTo(ref, k) {
+						kept[address] = true
+						break
+					}
+				}
+			}
+			grown = grown || kept[address]
+		}
+	}
+
+	keep := func(addresses []string) []string {
+		var k []string
+		for _, a := range addresses {
+			if kept[a] {
+				k = append(k, a)
+			}
+		}
+		return k
+	}
+	result.Added = keep(result.Added)
+	result.Modified = keep(result.Modified)
+	result.Removed = keep(result.Removed)
+
+	return result, nil
+}
+
+// changedInputs returns the reference roots whose values may have changed
+// through the files in changed: var and local when one of them declares
+// variables or locals or is a tfvars file, and path when one isn't a
+// configuration file, as it could be read with file() and the like.
+func changedInputs(opts *options, base string, changed map[string]bool) map[string]bool {
+	inputs := make(map[string]bool)
+	root := workDir(opts)
+	if r, err := gitCommand(opts, "rev-parse", "--show-toplevel").Output(); err == nil {
+		root = strings.TrimSpace(string(r))
+	}
+
+	for name, _ := range changed {
+		file := pathpkg.Base(name)
+		if strings.HasSuffix(file, ".tfvars") || strings.HasSuffix(file, ".tfvars.json") {
+			inputs["var"] = true
+			continue
+		}
+		if !strings.HasSuffix(file, ".tf") && !strings.HasSuffix(file, ".tf.json") {
+			inputs["path"] = true
+			continue
+		}
+
+		// either side may declare them
+		var sources [][]byte
+		if src, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+			sources = append(sources, src)
+		}
+		if src, err := gitCommand(opts, "show", base+":"+name).Output(); err == nil {
+			sources = append(sources, src)
+		}
+		for _, src := range sources {
+			if declaresInputs(src) {
+				inputs["var"] = true
+				inputs["local"] = true
+			}
+		}
+	}
+
+	return inputs
+}
+
+var inputBlock = regexp.MustCompile(`(?m)^\s*(variable\s|locals\s*\{)|"(variable|locals)"\s*:`)
+
+// declaresInputs tells whether src, in either syntax, has variable or
+// locals blocks. It may be wrong about comments, which only keeps more.
+func declaresInputs(src []byte) bool {
+	return inputBlock.Match(src)
+}
+
+// usesInputs tells whether the source of r refers to one of the roots in
+// inputs, such as var.
+func usesInputs(r *tfdiff.Resource, inputs map[string]bool) bool {
+	if len(inputs) == 0 {
+		return false
+	}
+	f, diags := hclsyntax.ParseConfig(r.Source, r.File, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return true
+	}
+	return bodyUsesInputs(f.Body.(*hclsyntax.Body), inputs)
+}
+
+func bodyUsesInputs(body *hclsyntax.Body, inputs map[string]bool) bool {
+	for _, attr := range body.Attributes {
+		for _, t := range attr.Expr.Variables() {
+			if inputs[t.RootName()] {
+				return true
+			}
+		}
+	}
+	for _, b := range body.Blocks {
+		if bodyUsesInputs(b.Body, inputs) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedFiles returns the repo-relative names of the files that differ
+// between base and the working tree, including untracked ones.
+func changedFiles(opts *options, base string) (map[string]bool, error) {
+	changed := make(map[string]bool)
+
+	for _, args := range [][]string{
+		{"diff", "--name-only", "--no-renames", base},
+		{"ls-files", "--others", "--exclude-standard", "--full-name"},
+	} {
+		cmd := gitCommand(opts, args...)
+		if args[0] == "ls-files" {
+			// ls-files lists paths below the current directory only
+			if root, err := gitCommand(opts, "rev-parse", "--show-toplevel").Output(); err == nil {
+				cmd.Dir = strings.TrimSpace(string(root))
+			}
+		}
+
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("git %s: %s", strings.Join(args, " "), err)
+		}
+		for _, name := range strings.Split(string(out), "\n") {
+			if name != "" {
+				changed[name] = true
+			}
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+)
+
+// Version 3 keys set blocks by their content rather than a digest of it.
+const snapshotVersion = 3
+
+type snapshotFile struct {
+	Version   int                          `json:"version"`
+	Resources map[string]*snapshotResource `json:"resources"`
+}
+
+type snapshotResource struct {
+	File       string                     `json:"file,omitempty"`
+	Line       int                        `json:"line,omitempty"`
+	Provider   string                     `json:"provider,omitempty"`
+	Attributes map[string]snapshotValue   `json:"attributes,omitempty"`
+	Blocks     map[string][]snapshotBlock `json:"blocks,omitempty"`
+}
+
+type snapshotBlock struct {
+	Attributes map[string]snapshotValue   `json:"attributes,omitempty"`
+	Blocks     map[string][]snapshotBlock `json:"blocks,omitempty"`
+}
+
+// snapshotValue stores the type next to the value so it can be decoded back
+// into an identical cty.Value. Unknown values have no JSON representation
+// and are recorded with Unknown set and their source text instead.
+type snapshotValue struct {
+	Type    json.RawMessage `json:"type"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Unknown bool            `json:"unknown,omitempty"`
+	Source  string          `json:"source,omitempty"`
+}
+
+func snapshot(opts *options, output string) error {
+	if err := parseVars(opts); err != nil {
+		return err
+	}
+
+	resources, err := localResources(opts)
+	if err != nil {
+		return err
+	}
+
+	return writeSnapshot(resources, output)
+}
+
+// writeSnapshot writes resources to output, or stdout if it's empty.
+func writeSnapshot(resources map[string]*tfdiff.Resource, output string) error {
+	s := snapshotFile{
+		Version:   snapshotVersion,
+		Resources: make(map[string]*snapshotResource),
+	}
+	for name, r := range resources {
+		sr, err := encodeSnapshotResource(r)
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		s.Resources[name] = sr
+	}
+
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	if output == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+
+	return ioutil.WriteFile(output, b, 0644)
+}
+
+func readSnapshot(filename string) (map[string]*tfdiff.Resource, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var s snapshotFile
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if s.Version != snapshotVersion {
+		return nil, fmt.Errorf("%s: unsupported snapshot version %d", filename, s.Version)
+	}
+
+	resources := make(map[string]*tfdiff.Resource)
+	for name, sr := range s.Resources {
+		r := &tfdiff.Resource{Name: name, File: sr.File, Line: sr.Line, Provider: sr.Provider}
+
+		if r.Attributes, r.Sources, err = decodeSnapshotValues(sr.Attributes); err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, name, err)
+		}
+		if r.Blocks, err = decodeSnapshotBlocks(sr.Blocks); err != nil {
+			return nil, fmt.Errorf("%s: %s: %s", filename, name, err)
+		}
+
+		resources[name] = r
+	}
+
+	return resources, nil
+}
+
+func encodeSnapshotResource(r *tfdiff.Resource) (*snapshotResource, error) {
+	attributes, err := encodeSnapshotValues(r.Attributes, r.Sources)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := encodeSnapshotBlocks(r.Blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &snapshotResource{
+		File:       r.File,
+		Line:       r.Line,
+		Provider:   r.Provider,
+		Attributes: attributes,
+		Blocks:     blocks,
+	}, nil
+}
+
+func encodeSnapshotBlocks(blocks map[string][]tfdiff.Block) (map[string][]snapshotBlock, error) {
+	if blocks == nil {
+		return nil, nil
+	}
+
+	sb := make(map[string][]snapshotBlock)
+	for typ, bs := range blocks {
+		for _, b := range bs {
+			attributes, err := encodeSnapshotValues(b.Attributes, b.Sources)
+			if err != nil {
+				return nil, err
+			}
+
+			nested, err := encodeSnapshotBlocks(b.Blocks)
+			if err != nil {
+				return nil, err
+			}
+
+			sb[typ] = append(sb[typ], snapshotBlock{Attributes: attributes, Blocks: nested})
+		}
+	}
+
+	return sb, nil
+}
+
+func encodeSnapshotValues(values map[string]cty.Value, sources map[string]string) (map[string]snapshotValue, error) {
+	if values == nil {
+		return nil, nil
+	}
+
+	sv := make(map[string]snapshotValue)
+	for name, v := range values {
+		t, err := ctyjson.MarshalType(v.Type())
+		if err != nil {
+			return nil, err
+		}
+
+		if !v.IsWhollyKnown() {
+			sv[name] = snapshotValue{Type: t, Unknown: true, Source: sources[name]}
+			continue
+		}
+
+		b, err := ctyjson.Marshal(v, v.Type())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", name, err)
+		}
+		sv[name] = snapshotValue{Type: t, Value: b}
+	}
+
+	return sv, nil
+}
+
+func decodeSnapshotBlocks(sb map[string][]snapshotBlock) (map[string][]tfdiff.Block, error) {
+	if sb == nil {
+		return nil, nil
+	}
+
+	blocks := make(map[string][]tfdiff.Block)
+	for typ, bs := range sb {
+		for _, b := range bs {
+			attributes, sources, err := decodeSnapshotValues(b.Attributes)
+			if err != nil {
+				return nil, err
+			}
+
+			nested, err := decodeSnapshotBlocks(b.Blocks)
+			if err != nil {
+				return nil, err
+			}
+
+			blocks[typ] = append(blocks[typ], tfdiff.Block{Attributes: attributes, Blocks: nested, Sources: sources})
+		}
+	}
+
+	return blocks, nil
+}
+
+func decodeSnapshotValues(sv map[string]snapshotValue) (map[string]cty.Value, map[string]string, error) {
+	if sv == nil {
+		return nil, nil, nil
+	}
+
+	values := make(map[string]cty.Value)
+	sources := make(map[string]string)
+	for name, v := range sv {
+		t, err := ctyjson.UnmarshalType(v.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", name, err)
+		}
+
+		if v.Unknown {
+			values[name] = cty.UnknownVal(t)
+			sources[name] = v.Source
+			continue
+		}
+
+		val, err := ctyjson.Unmarshal(v.Value, t)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", name, err)
+		}
+		values[name] = val
+	}
+
+	return values, sources, nil
+}
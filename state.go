@@ -0,0 +1,249 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// stateModule is the part of `terraform show -json` output describing the
+// resources of a module and its children.
+type stateModule struct {
+	Address   string `json:"address"`
+	Resources []struct {
+		Address string          `json:"address"`
+		Mode    string          `json:"mode"`
+		Type    string          `json:"type"`
+		Name    string          `json:"name"`
+		Index   json.RawMessage `json:"index"`
+	} `json:"resources"`
+	ChildModules []stateModule `json:"child_modules"`
+}
+
+// readState reads the resource instances of a `terraform show -json` state,
+// keyed by their addresses.
+func readState(filename string) (map[string]*tfdiff.Resource, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var state struct {
+		Values *struct {
+			RootModule stateModule `json:"root_module"`
+		} `json:"values"`
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	resources := make(map[string]*tfdiff.Resource)
+	if state.Values != nil {
+		addStateResources(resources, state.Values.RootModule)
+	}
+
+	return resources, nil
+}
+
+func addStateResources(resources map[string]*tfdiff.Resource, m stateModule) {
+	prefix := ""
+	if m.Address != "" {
+		prefix = m.Address + "."
+	}
+
+	for _, r := range m.Resources {
+		name := r.Address
+		if name == "" {
+			name = fmt.Sprintf("%s%s.%s", prefix, r.Type, r.Name)
+			if r.Mode == "data" {
+				name = fmt.Sprintf("%sdata.%s.%s", prefix, r.Type, r.Name)
+			}
+			if len(r.Index) > 0 {
+				name += "[" + string(r.Index) + "]"
+			}
+		}
+		resources[name] = &tfdiff.Resource{Name: name}
+	}
+
+	for _, c := range m.ChildModules {
+		addStateResources(resources, c)
+	}
+}
+
+// stripInstanceKeys turns module.a["x"].module.b[0] into module.a.module.b.
+func stripInstanceKeys(address string) string {
+	var b strings.Builder
+	depth := 0
+	quoted := false
+	for _, c := range address {
+		switch {
+		case quoted:
+			if c == '"' {
+				quoted = false
+			}
+		case c == '"' && depth > 0:
+			quoted = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case depth == 0:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// diffState reports the configured resources missing from the state as to
+// be created and the state resources missing from the configuration as to be
+// destroyed. Attributes aren't compared, since the state holds the values
+// computed by providers.
+//
+// Where count and for_each are known, instances are reconciled too: scaling
+// up reports the missing instances as added, scaling down the extra ones as
+// removed. Otherwise instance keys are ignored.
+func diffState(state, config map[string]*tfdiff.Resource) tfdiff.DiffResult {
+	result := tfdiff.DiffResult{}
+
+	// state instances by resource, without any instance keys
+	instances := make(map[string][]string)
+	for name, _ := range state {
+		instances[stripInstanceKeys(name)] = append(instances[stripInstanceKeys(name)], name)
+	}
+
+	configured := make(map[string]bool)
+	expected := make(map[string]bool)
+	inexact := make(map[string]bool)
+	for name, _ := range config {
+		resource := stripInstanceKeys(name)
+		configured[resource] = true
+
+		// module calls, outputs and the backend aren't resources in the state
+		if parts := localAddress(name); parts[0] == "module" || parts[0] == "output" || tfdiff.IsSetting(name) {
+			continue
+		}
+
+		keys, known := instanceAddresses(name, config[name])
+		if !known || !comparableModules(name, instances[resource]) {
+			inexact[resource] = true
+			if len(instances[resource]) == 0 && !config[name].Ignored {
+				result.Added = append(result.Added, name)
+			}
+			continue
+		}
+
+		var missing []string
+		for _, key := range keys {
+			expected[key] = true
+			if _, ok := state[key]; !ok {
+				missing = append(missing, key)
+			}
+		}
+		if config[name].Ignored || len(missing) == 0 {
+			continue
+		}
+		// a resource missing entirely is targeted as a whole
+		if len(missing) == len(keys) {
+			result.Added = append(result.Added, name)
+		} else {
+			result.Added = append(result.Added, missing...)
+		}
+	}
+
+	removed := make(map[string]bool)
+	for name, _ := range state {
+		resource := stripInstanceKeys(name)
+		if configured[resource] {
+			if !inexact[resource] && !expected[name] {
+				removed[name] = true
+			}
+			continue
+		}
+		// Modules whose source wasn't read can't tell what they contain.
+		if module := modulePath(resource); module != "" && !moduleLoaded(config, module) {
+			continue
+		}
+		removed[resource] = true
+	}
+	for name, _ := range removed {
+		result.Removed = append(result.Removed, name)
+	}
+
+	result.Sort()
+	return result
+}
+
+// instanceAddresses returns the addresses of the instances of a configured
+// resource, and whether its count or for_each is known.
+func instanceAddresses(name string, r *tfdiff.Resource) ([]string, bool) {
+	if count, ok := r.Attributes["count"]; ok {
+		if !count.IsKnown() || count.IsNull() || count.Type() != cty.Number {
+			return nil, false
+		}
+		n, _ := count.AsBigFloat().Int64()
+		if n > tfdiff.MaxCount {
+			return nil, false
+		}
+		var addresses []string
+		for i := int64(0); i < n; i++ {
+			addresses = append(addresses, fmt.Sprintf("%s[%d]", name, i))
+		}
+		return addresses, true
+	}
+
+	if forEach, ok := r.Attributes["for_each"]; ok {
+		if !forEach.IsWhollyKnown() || forEach.IsNull() {
+			return nil, false
+		}
+		var addresses []string
+		switch t := forEach.Type(); {
+		case t.IsMapType() || t.IsObjectType():
+			for k, _ := range forEach.AsValueMap() {
+				addresses = append(addresses, fmt.Sprintf("%s[%q]", name, k))
+			}
+		case t.IsSetType() && t.ElementType() == cty.String:
+			for _, v := range forEach.AsValueSlice() {
+				addresses = append(addresses, fmt.Sprintf("%s[%q]", name, v.AsString()))
+			}
+		default:
+			return nil, false
+		}
+		return addresses, true
+	}
+
+	return []string{name}, true
+}
+
+// comparableModules tells whether the module instances of a configured
+// resource could be expanded like those of its state instances. An address
+// without module instance keys where the state has them comes from a module
+// call whose count or for_each isn't known.
+func comparableModules(name string, instances []string) bool {
+	if strings.Contains(modulePath(name), "[") {
+		return true
+	}
+	for _, i := range instances {
+		if strings.Contains(modulePath(i), "[") {
+			return false
+		}
+	}
+	return true
+}
+
+func modulePath(address string) string {
+	local := strings.Join(localAddress(address), ".")
+	return strings.TrimSuffix(strings.TrimSuffix(address, local), ".")
+}
+
+func moduleLoaded(config map[string]*tfdiff.Resource, module string) bool {
+	for name, _ := range config {
+		if strings.HasPrefix(stripInstanceKeys(name), module+".") {
+			return true
+		}
+	}
+	return false
+}
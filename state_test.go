@@ -0,0 +1,29 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+	"github.com/zclconf/go-cty/cty"
+)
+
+func TestInstanceAddresses(t *testing.T) {
+	tests := []struct {
+		attributes map[string]cty.Value
+		want       []string
+		known      bool
+	}{
+		{nil, []string{"x_a.a"}, true},
+		{map[string]cty.Value{"count": cty.NumberIntVal(2)}, []string{"x_a.a[0]", "x_a.a[1]"}, true},
+		{map[string]cty.Value{"count": cty.NumberIntVal(1e9)}, nil, false},
+		{map[string]cty.Value{"count": cty.UnknownVal(cty.Number)}, nil, false},
+		{map[string]cty.Value{"for_each": cty.SetVal([]cty.Value{cty.StringVal("k")})}, []string{`x_a.a["k"]`}, true},
+	}
+	for _, tt := range tests {
+		got, known := instanceAddresses("x_a.a", &tfdiff.Resource{Attributes: tt.attributes})
+		if !reflect.DeepEqual(got, tt.want) || known != tt.known {
+			t.Errorf("instanceAddresses(%v) = %v, %v, want %v, %v", tt.attributes, got, known, tt.want, tt.known)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// phases are reported by --stats in this order.
+var phases = []string{"clone", "read", "parse", "diff"}
+
+// runStats accumulates the time spent in each phase of a run and what was
+// processed, for --stats. Nothing leaves the machine. The base side is
+// cloned while the target side is parsed, so it is locked.
+type runStats struct {
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	files     int
+	resources int
+}
+
+var stats = &runStats{durations: make(map[string]time.Duration)}
+
+// since adds the time elapsed since start to phase. It is meant to be
+// deferred.
+func (s *runStats) since(phase string, start time.Time) {
+	s.add(phase, time.Since(start))
+}
+
+func (s *runStats) add(phase string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.durations[phase] += d
+}
+
+func (s *runStats) get(phase string) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.durations[phase]
+}
+
+func (s *runStats) count(files, resources int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files += files
+	s.resources += resources
+}
+
+func (s *runStats) print(w io.Writer) {
+	for _, phase := range phases {
+		fmt.Fprintf(w, "%s: %s\n", phase, s.durations[phase].Round(time.Microsecond))
+	}
+	fmt.Fprintf(w, "files: %d, resources: %d\n", s.files, s.resources)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+	"text/template"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// writeTemplate executes the text/template in opts.outputTemplate on the
+// JSON output, so fields are named as in the structs: .Added, .Modified,
+// .Removed, .Targets, .Warnings, .FullPlan, .Batches, .Command and
+// .Changes, whose entries have .Address, .Reason, .MovedFrom and
+// .Attributes. Besides the
+// built-in functions, join, quote (for the shell) and json are available.
+// See templates/ for examples.
+func writeTemplate(w io.Writer, opts *options, result tfdiff.DiffResult, baseResources, targetResources map[string]*tfdiff.Resource) error {
+	text, err := ioutil.ReadFile(opts.outputTemplate)
+	if err != nil {
+		return err
+	}
+
+	tmpl, err := template.New(opts.outputTemplate).Funcs(template.FuncMap{
+		"join":  strings.Join,
+		"quote": shellQuote,
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	return tmpl.Execute(w, detailedJSONOutput(opts, result, baseResources, targetResources))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+// stageContext returns the context of a stage limited by timeout, or
+// without a deadline when timeout is zero.
+func stageContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// parseWithTimeout parses files, failing once --parse-timeout passes. The
+// parser can't be interrupted, but tfdiff exits on the error anyway.
+func parseWithTimeout(opts *options, p *tfdiff.Parser, files []tfdiff.File) (map[string]*tfdiff.Resource, error) {
+	if opts.parseTimeout <= 0 {
+		return p.Parse(files)
+	}
+
+	ctx, cancel := stageContext(opts.parseTimeout)
+	defer cancel()
+
+	type parsed struct {
+		resources map[string]*tfdiff.Resource
+		err       error
+	}
+	done := make(chan parsed, 1)
+	go func() {
+		resources, err := p.Parse(files)
+		done <- parsed{resources, err}
+	}()
+
+	select {
+	case d := <-done:
+		return d.resources, d.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("parsing timed out after %s (--parse-timeout)", opts.parseTimeout)
+	}
+}
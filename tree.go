@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+type treeNode struct {
+	label    string
+	children map[string]*treeNode
+}
+
+func (n *treeNode) child(key string) *treeNode {
+	if n.children == nil {
+		n.children = make(map[string]*treeNode)
+	}
+	c, ok := n.children[key]
+	if !ok {
+		c = &treeNode{label: key}
+		n.children[key] = c
+	}
+	return c
+}
+
+// writeTree renders the differing resources in their module hierarchy, with
+// the resources of each module grouped by type.
+func writeTree(w io.Writer, result tfdiff.DiffResult) error {
+	root := &treeNode{}
+	for _, address := range result.Added {
+		addTreeNode(root, address, "+")
+	}
+	for _, address := range result.Modified {
+		addTreeNode(root, address, "~")
+	}
+	for _, address := range result.Removed {
+		addTreeNode(root, address, "-")
+	}
+
+	for _, key := range sortedChildren(root) {
+		n := root.children[key]
+		fmt.Fprintln(w, n.label)
+		writeTreeChildren(w, n, "")
+	}
+
+	return nil
+}
+
+func addTreeNode(root *treeNode, address, mark string) {
+	n := root
+	parts := tfdiff.SplitAddress(address)
+	for len(parts) > 2 && parts[0] == "module" {
+		n = n.child("module." + parts[1])
+		parts = parts[2:]
+	}
+
+	// the module call itself
+	if parts[0] == "module" {
+		c := n.child(strings.Join(parts, "."))
+		c.label = mark + " " + strings.Join(parts, ".")
+		return
+	}
+
+	typ, name := parts[0], strings.Join(parts[1:], ".")
+	if typ == "data" && len(parts) > 2 {
+		typ, name = "data."+parts[1], strings.Join(parts[2:], ".")
+	}
+	n.child(typ).child(name).label = mark + " " + name
+}
+
+func writeTreeChildren(w io.Writer, n *treeNode, indent string) {
+	keys := sortedChildren(n)
+	for i, key := range keys {
+		connector, next := "├── ", "│   "
+		if i == len(keys)-1 {
+			connector, next = "└── ", "    "
+		}
+
+		fmt.Fprintf(w, "%s%s%s\n", indent, connector, n.children[key].label)
+		writeTreeChildren(w, n.children[key], indent+next)
+	}
+}
+
+func sortedChildren(n *treeNode) []string {
+	var keys []string
+	for key, _ := range n.children {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mizzy/tfdiff/pkg/tfdiff"
+)
+
+const webhookTimeout = 10 * time.Second
+
+func postWebhook(opts *options, result tfdiff.DiffResult) error {
+	body, err := json.Marshal(newJSONOutput(opts, result))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, opts.webhook, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	for _, h := range opts.webhookHeaders {
+		kv := strings.SplitN(h, ":", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("webhook: invalid header %q, expected \"Name: value\"", h)
+		}
+		req.Header.Set(strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s returned %s", opts.webhook, resp.Status)
+	}
+
+	return nil
+}